@@ -31,12 +31,25 @@ type NilValue struct{}
 
 func (NilValue) implValue() {}
 
+// FunValue represents a user-defined function and the scope it was declared in
 type FunValue struct {
-	Val Fun
+	Val     Fun
+	Closure *Scope
 }
 
 func (FunValue) implValue() {}
 
+// NativeFunValue represents a builtin function implemented in Go. Call
+// receives arguments already checked against Arity and the line of the call.
+type NativeFunValue struct {
+	Name  string
+	Arity int
+	Call  func(args []Value, line uint) Value
+}
+
+func (NativeFunValue) implValue() {}
+
+// ErrorValue represents a runtime error with the line it occurred on
 type ErrorValue struct {
 	Message string
 	Line    uint
@@ -120,7 +133,7 @@ func (v *Variable) Accept(visitor ExprVisitor) Value {
 	return visitor.VisitVariableExpr(v)
 }
 
-// PrintStatement (e.g., (1 + 2))
+// PrintStatement represents a print statement (e.g., print 1 + 2)
 type PrintStatement struct {
 	Expression Expr
 	Line       uint
@@ -130,7 +143,8 @@ func (g *PrintStatement) Accept(visitor ExprVisitor) Value {
 	return visitor.VisitPrintStatement(g)
 }
 
-// VarStatement (e.g., var a = 1)
+// VarStatement represents a variable declaration (e.g., var a = 1).
+// Expression is nil when the declaration has no initializer.
 type VarStatement struct {
 	name       string
 	Expression Expr
@@ -141,9 +155,14 @@ func (g *VarStatement) Accept(visitor ExprVisitor) Value {
 	return visitor.VisitVarStatement(g)
 }
 
+// Statements represents a sequence of statements (e.g., a; b; c)
 type Statements struct {
 	Exprs []Expr
 	Line  uint
+	// ends holds, for a parsed program, the token index just past each
+	// statement and its optional semicolon. IncrementalParse uses it to
+	// find statements an edit did not touch.
+	ends []int
 }
 
 func (g *Statements) Accept(visitor ExprVisitor) Value {
@@ -183,6 +202,7 @@ func (w *WhileStatement) Accept(visitor ExprVisitor) Value {
 	return visitor.VisitWhileStatement(w)
 }
 
+// ForStatement represents a for loop (e.g., for (init; condition; increment) body)
 type ForStatement struct {
 	Initializer Expr
 	Condition   Expr
@@ -206,6 +226,7 @@ func (c *Call) Accept(visitor ExprVisitor) Value {
 	return visitor.VisitCallExpr(c)
 }
 
+// Fun represents a function declaration (e.g., fun foo(a, b) { body })
 type Fun struct {
 	Name       string
 	Parameters []string
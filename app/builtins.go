@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// builtins are the native functions defined in every global scope
+var builtins = []NativeFunValue{
+	{Name: "clock", Arity: 0, Call: builtinClock},
+	{Name: "string_to_number", Arity: 1, Call: builtinStringToNumber},
+	{Name: "int_add", Arity: 2, Call: builtinIntAdd},
+	{Name: "int_subtract", Arity: 2, Call: builtinIntSubtract},
+	{Name: "int_multiply", Arity: 2, Call: builtinIntMultiply},
+	{Name: "int_divide", Arity: 2, Call: builtinIntDivide},
+	{Name: "string_length", Arity: 1, Call: builtinStringLength},
+	{Name: "string_append", Arity: 2, Call: builtinStringAppend},
+	{Name: "string_uppercase", Arity: 1, Call: builtinStringUppercase},
+	{Name: "string_lowercase", Arity: 1, Call: builtinStringLowercase},
+	{Name: "string_contains", Arity: 2, Call: builtinStringContains},
+	{Name: "string_index_of", Arity: 2, Call: builtinStringIndexOf},
+	{Name: "string_regex_match", Arity: 2, Call: builtinStringRegexMatch},
+	{Name: "string_regex_find", Arity: 2, Call: builtinStringRegexFind},
+	{Name: "string_regex_replace", Arity: 3, Call: builtinStringRegexReplace},
+	// sqrt of a negative number is NaN rather than an error, matching IEEE
+	// arithmetic; round takes halves away from zero (round(-2.5) is -3)
+	{Name: "sqrt", Arity: 1, Call: mathFunction("sqrt", math.Sqrt)},
+	{Name: "floor", Arity: 1, Call: mathFunction("floor", math.Floor)},
+	{Name: "ceil", Arity: 1, Call: mathFunction("ceil", math.Ceil)},
+	{Name: "round", Arity: 1, Call: mathFunction("round", math.Round)},
+	{Name: "abs", Arity: 1, Call: mathFunction("abs", math.Abs)},
+}
+
+// NewGlobalScope creates a root scope with the builtins defined
+func NewGlobalScope() *Scope {
+	scope := NewScope(nil)
+	for _, builtin := range builtins {
+		scope.define(builtin.Name, builtin)
+	}
+	return scope
+}
+
+// builtinClock returns the current time in seconds since the Unix epoch
+func builtinClock(args []Value, line uint) Value {
+	return NumberValue{Val: float64(time.Now().Unix())}
+}
+
+// builtinStringToNumber parses integer, decimal and scientific forms such as
+// "3", "3.14" and "2e3", ignoring surrounding whitespace. Lox has no result
+// type, so input that is not a number (or overflows) yields nil.
+func builtinStringToNumber(args []Value, line uint) Value {
+	str, errVal := stringArg("string_to_number", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil {
+		return NilValue{}
+	}
+	return NumberValue{Val: number}
+}
+
+func builtinIntAdd(args []Value, line uint) Value {
+	return intOperation("int_add", args, line, func(a, b float64) float64 { return a + b })
+}
+
+func builtinIntSubtract(args []Value, line uint) Value {
+	return intOperation("int_subtract", args, line, func(a, b float64) float64 { return a - b })
+}
+
+func builtinIntMultiply(args []Value, line uint) Value {
+	return intOperation("int_multiply", args, line, func(a, b float64) float64 { return a * b })
+}
+
+// builtinIntDivide divides two integers, truncating toward zero
+func builtinIntDivide(args []Value, line uint) Value {
+	if divisor, errVal := intArg("int_divide", args, 1, line); errVal == nil && divisor == 0 {
+		return ErrorValue{Message: "Division by zero", Line: line}
+	}
+	return intOperation("int_divide", args, line, func(a, b float64) float64 { return math.Trunc(a / b) })
+}
+
+// intOperation applies op to the two integer arguments of builtin
+func intOperation(builtin string, args []Value, line uint, op func(a, b float64) float64) Value {
+	left, errVal := intArg(builtin, args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	right, errVal := intArg(builtin, args, 1, line)
+	if errVal != nil {
+		return errVal
+	}
+	return NumberValue{Val: op(left, right)}
+}
+
+// intArg returns args[i] if it is a finite whole number, or an ErrorValue
+// naming the builtin. Infinities equal their own truncation, so they are
+// ruled out separately.
+func intArg(builtin string, args []Value, i int, line uint) (float64, Value) {
+	if num, ok := args[i].(NumberValue); ok && num.Val == math.Trunc(num.Val) && !math.IsInf(num.Val, 0) {
+		return num.Val, nil
+	}
+	return 0, ErrorValue{Message: fmt.Sprintf("Arguments to %s must be integers", builtin), Line: line}
+}
+
+// mathFunction makes a builtin applying op to its single number argument
+func mathFunction(builtin string, op func(float64) float64) func(args []Value, line uint) Value {
+	return func(args []Value, line uint) Value {
+		num, ok := args[0].(NumberValue)
+		if !ok {
+			return ErrorValue{Message: fmt.Sprintf("Argument to %s must be a number", builtin), Line: line}
+		}
+		return NumberValue{Val: op(num.Val)}
+	}
+}
+
+// builtinStringLength counts characters (runes), not bytes
+func builtinStringLength(args []Value, line uint) Value {
+	str, errVal := stringArg("string_length", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	return NumberValue{Val: float64(utf8.RuneCountInString(str))}
+}
+
+func builtinStringAppend(args []Value, line uint) Value {
+	first, errVal := stringArg("string_append", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	second, errVal := stringArg("string_append", args, 1, line)
+	if errVal != nil {
+		return errVal
+	}
+	return StringValue{Val: first + second}
+}
+
+func builtinStringUppercase(args []Value, line uint) Value {
+	str, errVal := stringArg("string_uppercase", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	return StringValue{Val: strings.ToUpper(str)}
+}
+
+func builtinStringLowercase(args []Value, line uint) Value {
+	str, errVal := stringArg("string_lowercase", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	return StringValue{Val: strings.ToLower(str)}
+}
+
+func builtinStringContains(args []Value, line uint) Value {
+	str, errVal := stringArg("string_contains", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	substr, errVal := stringArg("string_contains", args, 1, line)
+	if errVal != nil {
+		return errVal
+	}
+	return BoolValue{Val: strings.Contains(str, substr)}
+}
+
+// builtinStringIndexOf returns the character (rune) offset of the first
+// occurrence of the substring, or nil when it does not occur
+func builtinStringIndexOf(args []Value, line uint) Value {
+	str, errVal := stringArg("string_index_of", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	substr, errVal := stringArg("string_index_of", args, 1, line)
+	if errVal != nil {
+		return errVal
+	}
+	byteIndex := strings.Index(str, substr)
+	if byteIndex < 0 {
+		return NilValue{}
+	}
+	return NumberValue{Val: float64(utf8.RuneCountInString(str[:byteIndex]))}
+}
+
+// builtinStringRegexMatch reports whether the pattern matches anywhere in
+// the string, using Go's regexp (RE2) syntax
+func builtinStringRegexMatch(args []Value, line uint) Value {
+	str, errVal := stringArg("string_regex_match", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	re, errVal := regexArg("string_regex_match", args, 1, line)
+	if errVal != nil {
+		return errVal
+	}
+	return BoolValue{Val: re.MatchString(str)}
+}
+
+// builtinStringRegexFind returns the leftmost match of the pattern, or nil
+// when there is none
+func builtinStringRegexFind(args []Value, line uint) Value {
+	str, errVal := stringArg("string_regex_find", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	re, errVal := regexArg("string_regex_find", args, 1, line)
+	if errVal != nil {
+		return errVal
+	}
+	match := re.FindStringIndex(str)
+	if match == nil {
+		return NilValue{}
+	}
+	return StringValue{Val: str[match[0]:match[1]]}
+}
+
+// builtinStringRegexReplace replaces every match of the pattern. The
+// replacement may refer to capture groups as $1 or ${name}.
+func builtinStringRegexReplace(args []Value, line uint) Value {
+	str, errVal := stringArg("string_regex_replace", args, 0, line)
+	if errVal != nil {
+		return errVal
+	}
+	re, errVal := regexArg("string_regex_replace", args, 1, line)
+	if errVal != nil {
+		return errVal
+	}
+	replacement, errVal := stringArg("string_regex_replace", args, 2, line)
+	if errVal != nil {
+		return errVal
+	}
+	return StringValue{Val: re.ReplaceAllString(str, replacement)}
+}
+
+// regexArg compiles args[i] as a regular expression, or returns an
+// ErrorValue naming the builtin when it is not a string or does not compile
+func regexArg(builtin string, args []Value, i int, line uint) (*regexp.Regexp, Value) {
+	pattern, errVal := stringArg(builtin, args, i, line)
+	if errVal != nil {
+		return nil, errVal
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, ErrorValue{Message: fmt.Sprintf("Invalid pattern for %s: %v", builtin, err), Line: line}
+	}
+	return re, nil
+}
+
+// stringArg returns args[i] as a string, or an ErrorValue naming the builtin
+func stringArg(builtin string, args []Value, i int, line uint) (string, Value) {
+	if str, ok := args[i].(StringValue); ok {
+		return str.Val, nil
+	}
+	return "", ErrorValue{Message: fmt.Sprintf("Argument to %s must be a string", builtin), Line: line}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ASTCache memoizes parse results on disk, keyed by a hash of the source
+// text and parserVersion so any edit to a file, or to how it parses,
+// invalidates its entry
+type ASTCache struct {
+	Dir string
+}
+
+// astCacheMaxAge is how long an entry is kept after it was last used.
+// Older entries are removed whenever a new one is stored, so the cache does
+// not grow without bound.
+const astCacheMaxAge = 30 * 24 * time.Hour
+
+// DefaultASTCacheDir returns the per-user cache directory for parsed
+// programs. There is no fallback when the user has none: a shared
+// directory such as the temp directory would let other users plant
+// entries that get evaluated as someone else's program.
+func DefaultASTCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lox-interpreter", "ast"), nil
+}
+
+// Parse returns the cached AST for source, calling parse only when there
+// is no usable entry. Failed parses are not cached so their errors are
+// reported on every run. The cache is best effort: entries that cannot be
+// read or written are simply reparsed.
+func (c ASTCache) Parse(source []byte, parse func(source []byte) (Expr, error)) (Expr, error) {
+	path := c.path(source)
+	if data, err := os.ReadFile(path); err == nil {
+		if expr, err := DecodeAST(data); err == nil {
+			now := time.Now()
+			os.Chtimes(path, now, now)
+			return expr, nil
+		}
+	}
+
+	expr, err := parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := EncodeAST(expr); err == nil {
+		c.store(path, data)
+	}
+	return expr, nil
+}
+
+func (c ASTCache) path(source []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\n", parserVersion)
+	hash.Write(source)
+	return filepath.Join(c.Dir, hex.EncodeToString(hash.Sum(nil)))
+}
+
+// store writes through a temp file and rename so concurrent runs never see
+// a partially written entry. The directory is private to the user.
+func (c ASTCache) store(path string, data []byte) {
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(c.Dir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, writeErr := tmp.Write(data)
+	closeErr := tmp.Close()
+	if writeErr != nil || closeErr != nil || os.Rename(tmp.Name(), path) != nil {
+		os.Remove(tmp.Name())
+	}
+	c.prune()
+}
+
+// prune removes entries, and temp files left by interrupted runs, that
+// have not been used for astCacheMaxAge
+func (c ASTCache) prune() {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > astCacheMaxAge {
+			os.Remove(filepath.Join(c.Dir, entry.Name()))
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingParse wraps parseSource and counts how often parsing runs, so
+// tests can observe when the cache skips it
+func countingParse(count *int) func(source []byte) (Expr, error) {
+	return func(source []byte) (Expr, error) {
+		*count++
+		return parseSource(source)
+	}
+}
+
+func TestASTCacheReusesUnchangedSource(t *testing.T) {
+	cache := ASTCache{Dir: t.TempDir()}
+	parses := 0
+	printer := &AstPrinter{}
+
+	first, err := cache.Parse([]byte("print 1 + 2;"), countingParse(&parses))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	second, err := cache.Parse([]byte("print 1 + 2;"), countingParse(&parses))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if parses != 1 {
+		t.Errorf("Expected the second run to skip parsing, parsed %d times", parses)
+	}
+	if printer.Print(second) != printer.Print(first) {
+		t.Errorf("Expected %s from the cache, got %s", printer.Print(first), printer.Print(second))
+	}
+}
+
+func TestASTCacheInvalidatedByEdit(t *testing.T) {
+	cache := ASTCache{Dir: t.TempDir()}
+	parses := 0
+
+	if _, err := cache.Parse([]byte("print 1;"), countingParse(&parses)); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	edited, err := cache.Parse([]byte("print 2;"), countingParse(&parses))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if parses != 2 {
+		t.Errorf("Expected the edited source to be parsed again, parsed %d times", parses)
+	}
+	if result := (&AstPrinter{}).Print(edited); result != "(print 2.0)" {
+		t.Errorf("Expected (print 2.0), got %s", result)
+	}
+}
+
+func TestASTCacheSkipsErrorsAndCorruptEntries(t *testing.T) {
+	cache := ASTCache{Dir: t.TempDir()}
+	parses := 0
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Parse([]byte("print ;"), countingParse(&parses)); err == nil {
+			t.Fatal("Expected a parse error")
+		}
+	}
+	if parses != 2 {
+		t.Errorf("Expected failed parses not to be cached, parsed %d times", parses)
+	}
+
+	source := []byte("print 1;")
+	if err := os.WriteFile(cache.path(source), []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Parse(source, countingParse(&parses)); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if parses != 3 {
+		t.Errorf("Expected a corrupt entry to be reparsed, parsed %d times", parses)
+	}
+}
+
+func TestASTCacheDirIsPrivate(t *testing.T) {
+	cache := ASTCache{Dir: filepath.Join(t.TempDir(), "ast")}
+	if _, err := cache.Parse([]byte("print 1;"), parseSource); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	info, err := os.Stat(cache.Dir)
+	if err != nil {
+		t.Fatalf("Expected the cache directory to be created: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		t.Errorf("Expected a directory private to the user, got mode %v", perm)
+	}
+}
+
+func TestCacheSkippedWithoutUserCacheDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("HOME", "")
+	if dir, err := DefaultASTCacheDir(); err == nil {
+		t.Fatalf("Expected no default cache directory, got %s", dir)
+	}
+
+	if code := runHandler("evaluate", writeProgram(t, "1 + 2"), Options{Cache: true, Formatter: HumanFormatter{}}); code != 0 {
+		t.Errorf("Expected evaluation to succeed without a cache, got exit code %d", code)
+	}
+}
+
+func TestASTCacheKeyIncludesParserVersion(t *testing.T) {
+	cache := ASTCache{Dir: t.TempDir()}
+	source := []byte("print 1;")
+
+	// An entry keyed by the source alone, as a build that parsed it
+	// differently might have left, must not be served
+	stale, err := EncodeAST(&Literal{Value: StringValue{Val: "stale"}, Line: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(source)
+	if err := os.WriteFile(filepath.Join(cache.Dir, hex.EncodeToString(sum[:])), stale, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	expr, err := cache.Parse(source, parseSource)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if result := (&AstPrinter{}).Print(expr); result != "(print 1.0)" {
+		t.Errorf("Expected (print 1.0), got %s", result)
+	}
+}
+
+func TestASTCachePrunesUnusedEntries(t *testing.T) {
+	cache := ASTCache{Dir: t.TempDir()}
+	old := filepath.Join(cache.Dir, "old")
+	recent := filepath.Join(cache.Dir, "recent")
+	for _, path := range []string{old, recent} {
+		if err := os.WriteFile(path, []byte("entry"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expired := time.Now().Add(-astCacheMaxAge - time.Hour)
+	if err := os.Chtimes(old, expired, expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.Parse([]byte("print 1;"), parseSource); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Expected the unused entry to be removed, got %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Expected the recent entry to be kept: %v", err)
+	}
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Values are encoded as a one-byte tag followed by the payload for that
+// tag: 8 big-endian bytes of IEEE 754 bits for numbers, and a uvarint byte
+// length followed by the UTF-8 bytes for strings.
+const (
+	valueTagNil byte = iota
+	valueTagFalse
+	valueTagTrue
+	valueTagNumber
+	valueTagString
+)
+
+var errTruncated = errors.New("unexpected end of encoded data")
+
+// EncodeValue encodes a runtime value in a compact binary form. Functions
+// cannot be encoded since they close over a live scope.
+func EncodeValue(value Value) ([]byte, error) {
+	return appendValue(nil, value)
+}
+
+// DecodeValue decodes a value produced by EncodeValue
+func DecodeValue(data []byte) (Value, error) {
+	value, rest, err := readValue(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after encoded value", len(rest))
+	}
+	return value, nil
+}
+
+func appendValue(buf []byte, value Value) ([]byte, error) {
+	switch v := value.(type) {
+	case NilValue:
+		return append(buf, valueTagNil), nil
+	case BoolValue:
+		if v.Val {
+			return append(buf, valueTagTrue), nil
+		}
+		return append(buf, valueTagFalse), nil
+	case NumberValue:
+		buf = append(buf, valueTagNumber)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v.Val)), nil
+	case StringValue:
+		buf = append(buf, valueTagString)
+		return appendString(buf, v.Val), nil
+	default:
+		return nil, fmt.Errorf("cannot encode %s", formatValue(value, 0))
+	}
+}
+
+func readValue(data []byte) (Value, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errTruncated
+	}
+	tag, data := data[0], data[1:]
+	switch tag {
+	case valueTagNil:
+		return NilValue{}, data, nil
+	case valueTagFalse:
+		return BoolValue{Val: false}, data, nil
+	case valueTagTrue:
+		return BoolValue{Val: true}, data, nil
+	case valueTagNumber:
+		if len(data) < 8 {
+			return nil, nil, errTruncated
+		}
+		bits := binary.BigEndian.Uint64(data)
+		return NumberValue{Val: math.Float64frombits(bits)}, data[8:], nil
+	case valueTagString:
+		str, rest, err := readString(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		return StringValue{Val: str}, rest, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown value tag %d", tag)
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func readString(data []byte) (string, []byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return "", nil, errTruncated
+	}
+	data = data[n:]
+	return string(data[:length]), data[length:], nil
+}
+
+// astMagic starts every encoded AST, followed by astVersion. Bump the
+// version whenever the node encoding changes so stale caches are rejected
+// instead of misread.
+const (
+	astMagic   = "LOXAST"
+	astVersion = 2
+)
+
+// Each node is encoded as a one-byte tag, its fields in declaration order
+// and then its line. Child lists are a uvarint count followed by the nodes.
+const (
+	exprTagNil byte = iota
+	exprTagBinary
+	exprTagGrouping
+	exprTagLiteral
+	exprTagUnary
+	exprTagVariable
+	exprTagPrint
+	exprTagVar
+	exprTagStatements
+	exprTagBlock
+	exprTagIf
+	exprTagWhile
+	exprTagFor
+	exprTagCall
+	exprTagFun
+)
+
+// EncodeAST encodes a parsed program, including line numbers, in a compact
+// binary form that DecodeAST reads back into an identical tree
+func EncodeAST(expr Expr) ([]byte, error) {
+	buf := append([]byte(astMagic), astVersion)
+	return appendExpr(buf, expr)
+}
+
+// DecodeAST decodes a program produced by EncodeAST. Data written by a
+// different format version is rejected.
+func DecodeAST(data []byte) (Expr, error) {
+	if len(data) < len(astMagic)+1 || string(data[:len(astMagic)]) != astMagic {
+		return nil, errors.New("not an encoded AST")
+	}
+	data = data[len(astMagic):]
+	if version := data[0]; version != astVersion {
+		return nil, fmt.Errorf("unsupported AST format version %d (expected %d)", version, astVersion)
+	}
+	expr, rest, err := readExpr(data[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes after encoded AST", len(rest))
+	}
+	return expr, nil
+}
+
+func appendExpr(buf []byte, expr Expr) ([]byte, error) {
+	var err error
+	switch e := expr.(type) {
+	case nil:
+		return append(buf, exprTagNil), nil
+	case *Binary:
+		buf = append(buf, exprTagBinary)
+		if buf, err = appendExprs(buf, e.Left); err != nil {
+			return nil, err
+		}
+		buf = appendToken(buf, e.Operator)
+		if buf, err = appendExprs(buf, e.Right); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *Grouping:
+		buf = append(buf, exprTagGrouping)
+		if buf, err = appendExprs(buf, e.Expression); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *Literal:
+		buf = append(buf, exprTagLiteral)
+		if buf, err = appendValue(buf, e.Value); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *Unary:
+		buf = append(buf, exprTagUnary)
+		buf = appendToken(buf, e.Operator)
+		if buf, err = appendExprs(buf, e.Right); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *Variable:
+		buf = append(buf, exprTagVariable)
+		buf = appendToken(buf, e.Name)
+		return appendLine(buf, e.Line), nil
+	case *PrintStatement:
+		buf = append(buf, exprTagPrint)
+		if buf, err = appendExprs(buf, e.Expression); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *VarStatement:
+		buf = append(buf, exprTagVar)
+		buf = appendString(buf, e.name)
+		if buf, err = appendExprs(buf, e.Expression); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *Statements:
+		buf = append(buf, exprTagStatements)
+		if buf, err = appendExprList(buf, e.Exprs); err != nil {
+			return nil, err
+		}
+		buf = binary.AppendUvarint(buf, uint64(len(e.ends)))
+		for _, end := range e.ends {
+			buf = binary.AppendUvarint(buf, uint64(end))
+		}
+		return appendLine(buf, e.Line), nil
+	case *Block:
+		buf = append(buf, exprTagBlock)
+		if buf, err = appendExprList(buf, e.Statements); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *IfStatement:
+		buf = append(buf, exprTagIf)
+		if buf, err = appendExprs(buf, e.Condition, e.ThenBranch, e.ElseBranch); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *WhileStatement:
+		buf = append(buf, exprTagWhile)
+		if buf, err = appendExprs(buf, e.Condition, e.Body); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *ForStatement:
+		buf = append(buf, exprTagFor)
+		if buf, err = appendExprs(buf, e.Initializer, e.Condition, e.Increment, e.Body); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *Call:
+		buf = append(buf, exprTagCall)
+		if buf, err = appendExprs(buf, e.Callee); err != nil {
+			return nil, err
+		}
+		if buf, err = appendExprList(buf, e.Arguments); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	case *Fun:
+		buf = append(buf, exprTagFun)
+		buf = appendString(buf, e.Name)
+		buf = binary.AppendUvarint(buf, uint64(len(e.Parameters)))
+		for _, param := range e.Parameters {
+			buf = appendString(buf, param)
+		}
+		if buf, err = appendExprs(buf, &e.Block); err != nil {
+			return nil, err
+		}
+		return appendLine(buf, e.Line), nil
+	default:
+		return nil, fmt.Errorf("cannot encode %T", expr)
+	}
+}
+
+// appendExprs encodes each of exprs in turn
+func appendExprs(buf []byte, exprs ...Expr) ([]byte, error) {
+	var err error
+	for _, expr := range exprs {
+		if buf, err = appendExpr(buf, expr); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// appendExprList encodes exprs with a count so the list can be read back
+func appendExprList(buf []byte, exprs []Expr) ([]byte, error) {
+	buf = binary.AppendUvarint(buf, uint64(len(exprs)))
+	return appendExprs(buf, exprs...)
+}
+
+func appendToken(buf []byte, token Token) []byte {
+	buf = binary.AppendUvarint(buf, uint64(token.Type))
+	buf = appendString(buf, token.Lexeme)
+	buf = appendString(buf, token.Literal)
+	return appendLine(buf, token.Line)
+}
+
+func appendLine(buf []byte, line uint) []byte {
+	return binary.AppendUvarint(buf, uint64(line))
+}
+
+func readExpr(data []byte) (Expr, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errTruncated
+	}
+	tag, data := data[0], data[1:]
+	var err error
+	switch tag {
+	case exprTagNil:
+		return nil, data, nil
+	case exprTagBinary:
+		expr := &Binary{}
+		if expr.Left, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Operator, data, err = readToken(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Right, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagGrouping:
+		expr := &Grouping{}
+		if expr.Expression, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagLiteral:
+		expr := &Literal{}
+		if expr.Value, data, err = readValue(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagUnary:
+		expr := &Unary{}
+		if expr.Operator, data, err = readToken(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Right, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagVariable:
+		expr := &Variable{}
+		if expr.Name, data, err = readToken(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagPrint:
+		expr := &PrintStatement{}
+		if expr.Expression, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagVar:
+		expr := &VarStatement{}
+		if expr.name, data, err = readString(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Expression, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagStatements:
+		expr := &Statements{}
+		if expr.Exprs, data, err = readExprList(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.ends, data, err = readInts(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagBlock:
+		expr := &Block{}
+		if expr.Statements, data, err = readExprList(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagIf:
+		expr := &IfStatement{}
+		if expr.Condition, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.ThenBranch, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.ElseBranch, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagWhile:
+		expr := &WhileStatement{}
+		if expr.Condition, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Body, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagFor:
+		expr := &ForStatement{}
+		if expr.Initializer, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Condition, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Increment, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Body, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagCall:
+		expr := &Call{}
+		if expr.Callee, data, err = readExpr(data); err != nil {
+			return nil, nil, err
+		}
+		if expr.Arguments, data, err = readExprList(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Line, data, err = readLine(data)
+		return expr, data, err
+	case exprTagFun:
+		return readFun(data)
+	default:
+		return nil, nil, fmt.Errorf("unknown node tag %d", tag)
+	}
+}
+
+func readFun(data []byte) (Expr, []byte, error) {
+	expr := &Fun{}
+	var err error
+	if expr.Name, data, err = readString(data); err != nil {
+		return nil, nil, err
+	}
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, errTruncated
+	}
+	data = data[n:]
+	for i := uint64(0); i < count; i++ {
+		var param string
+		if param, data, err = readString(data); err != nil {
+			return nil, nil, err
+		}
+		expr.Parameters = append(expr.Parameters, param)
+	}
+
+	var body Expr
+	if body, data, err = readExpr(data); err != nil {
+		return nil, nil, err
+	}
+	block, ok := body.(*Block)
+	if !ok {
+		return nil, nil, fmt.Errorf("function %s has no block body", expr.Name)
+	}
+	expr.Block = *block
+	expr.Line, data, err = readLine(data)
+	return expr, data, err
+}
+
+// readExprList reads a counted list, returning nil for an empty one just as
+// the parser does
+func readExprList(data []byte) ([]Expr, []byte, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, errTruncated
+	}
+	data = data[n:]
+	var exprs []Expr
+	for i := uint64(0); i < count; i++ {
+		expr, rest, err := readExpr(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		exprs = append(exprs, expr)
+		data = rest
+	}
+	return exprs, data, nil
+}
+
+// readInts reads a counted list of uvarints, returning nil for an empty one
+func readInts(data []byte) ([]int, []byte, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, errTruncated
+	}
+	data = data[n:]
+	var ints []int
+	for i := uint64(0); i < count; i++ {
+		value, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, nil, errTruncated
+		}
+		ints = append(ints, int(value))
+		data = data[n:]
+	}
+	return ints, data, nil
+}
+
+func readToken(data []byte) (Token, []byte, error) {
+	var token Token
+	tokenType, n := binary.Uvarint(data)
+	if n <= 0 {
+		return token, nil, errTruncated
+	}
+	token.Type = TokenType(tokenType)
+	var err error
+	if token.Lexeme, data, err = readString(data[n:]); err != nil {
+		return token, nil, err
+	}
+	if token.Literal, data, err = readString(data); err != nil {
+		return token, nil, err
+	}
+	token.Line, data, err = readLine(data)
+	return token, data, err
+}
+
+func readLine(data []byte) (uint, []byte, error) {
+	line, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, errTruncated
+	}
+	return uint(line), data[n:], nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestValueEncodingRoundTrip(t *testing.T) {
+	values := map[string]Value{
+		"Nil":       NilValue{},
+		"True":      BoolValue{Val: true},
+		"False":     BoolValue{Val: false},
+		"Integer":   NumberValue{Val: 42},
+		"Fraction":  NumberValue{Val: -0.1},
+		"Infinity":  NumberValue{Val: math.Inf(1)},
+		"String":    StringValue{Val: "héllo\nworld"},
+		"EmptyText": StringValue{Val: ""},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := EncodeValue(value)
+			if err != nil {
+				t.Fatalf("EncodeValue(%v) failed: %v", value, err)
+			}
+			decoded, err := DecodeValue(encoded)
+			if err != nil {
+				t.Fatalf("DecodeValue failed: %v", err)
+			}
+			if decoded != value {
+				t.Errorf("Expected %#v, got %#v", value, decoded)
+			}
+		})
+	}
+}
+
+func TestValueEncodingRejectsFunctions(t *testing.T) {
+	for _, value := range []Value{builtins[0], FunValue{Val: Fun{Name: "f"}}} {
+		if _, err := EncodeValue(value); err == nil {
+			t.Errorf("Expected an error encoding %s", formatValue(value, 0))
+		}
+	}
+}
+
+func TestValueDecodingRejectsBadInput(t *testing.T) {
+	inputs := map[string][]byte{
+		"Empty":           {},
+		"UnknownTag":      {0xff},
+		"TruncatedNumber": {valueTagNumber, 0, 0},
+		"TruncatedString": {valueTagString, 5, 'a'},
+		"TrailingBytes":   {valueTagNil, valueTagNil},
+	}
+
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			if value, err := DecodeValue(input); err == nil {
+				t.Errorf("Expected an error, got %#v", value)
+			}
+		})
+	}
+}
+
+func TestASTEncodingRoundTrip(t *testing.T) {
+	testCases, err := loadParserTests()
+	if err != nil {
+		t.Fatalf("Failed to load test cases: %v", err)
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			tokens, err := TokenizeString(tc.Input)
+			if err != nil {
+				t.Skip("input does not tokenize")
+			}
+			expr, err := NewParser(tokens).Parse()
+			if err != nil {
+				t.Skip("input does not parse")
+			}
+
+			encoded, err := EncodeAST(expr)
+			if err != nil {
+				t.Fatalf("EncodeAST failed: %v", err)
+			}
+			decoded, err := DecodeAST(encoded)
+			if err != nil {
+				t.Fatalf("DecodeAST failed: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, expr) {
+				printer := &AstPrinter{}
+				t.Errorf("Round trip changed the AST:\nExpected:\n%s\nGot:\n%s", printer.Print(expr), printer.Print(decoded))
+			}
+		})
+	}
+}
+
+func TestASTDecodingRejectsOtherVersions(t *testing.T) {
+	encoded, err := EncodeAST(&Literal{Value: NumberValue{Val: 1}, Line: 1})
+	if err != nil {
+		t.Fatalf("EncodeAST failed: %v", err)
+	}
+
+	encoded[len(astMagic)] = astVersion + 1
+	if _, err := DecodeAST(encoded); err == nil {
+		t.Error("Expected an error decoding a different format version")
+	}
+	if _, err := DecodeAST([]byte("not an AST")); err == nil {
+		t.Error("Expected an error decoding data without the header")
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"io"
-	"time"
 )
 
 // Scope represents a variable scope with optional parent scope
@@ -37,6 +36,18 @@ func (s *Scope) isDefined(name string) bool {
 	return exists
 }
 
+// uninitializedValue marks a variable declared without an initializer.
+// It never escapes the scope: reading the variable yields nil, or an error
+// in strict mode.
+type uninitializedValue struct{}
+
+func (uninitializedValue) implValue() {}
+
+// declare adds an uninitialized variable to the current scope
+func (s *Scope) declare(name string) {
+	s.envMap[name] = uninitializedValue{}
+}
+
 // define adds a variable to the current scope
 func (s *Scope) define(name string, value Value) {
 	s.envMap[name] = value
@@ -58,8 +69,19 @@ func (s *Scope) assign(name string, value Value) bool {
 type Evaluator struct {
 	scope  *Scope
 	output io.Writer
+	// strictVars makes reading a declared but unassigned variable an error
+	// instead of nil
+	strictVars bool
+	// loopReturnsLast makes while and for loops evaluate to the value of
+	// their last body run (nil if the body never ran) instead of nil
+	loopReturnsLast bool
+	// precision is the number of significant digits print shows for
+	// numbers, zero for the shortest exact form
+	precision int
 }
 
+var _ ExprVisitor = (*Evaluator)(nil)
+
 // NewEvaluator creates a new evaluator with the given scope and output writer
 func NewEvaluator(scope *Scope, output io.Writer) *Evaluator {
 	return &Evaluator{
@@ -173,6 +195,11 @@ func (e *Evaluator) VisitBinaryExpr(expr *Binary) Value {
 				return BoolValue{Val: leftNum.Val < rightNum.Val}
 			}
 		}
+		if leftStr, ok := left.(StringValue); ok {
+			if rightStr, ok := right.(StringValue); ok {
+				return BoolValue{Val: leftStr.Val < rightStr.Val}
+			}
+		}
 		return ErrorValue{Message: "Operands must be numbers", Line: expr.Line}
 	case LESS_EQUAL:
 		if leftNum, ok := left.(NumberValue); ok {
@@ -180,6 +207,11 @@ func (e *Evaluator) VisitBinaryExpr(expr *Binary) Value {
 				return BoolValue{Val: leftNum.Val <= rightNum.Val}
 			}
 		}
+		if leftStr, ok := left.(StringValue); ok {
+			if rightStr, ok := right.(StringValue); ok {
+				return BoolValue{Val: leftStr.Val <= rightStr.Val}
+			}
+		}
 		return ErrorValue{Message: "Operands must be numbers", Line: expr.Line}
 	case GREATER:
 		if leftNum, ok := left.(NumberValue); ok {
@@ -187,6 +219,11 @@ func (e *Evaluator) VisitBinaryExpr(expr *Binary) Value {
 				return BoolValue{Val: leftNum.Val > rightNum.Val}
 			}
 		}
+		if leftStr, ok := left.(StringValue); ok {
+			if rightStr, ok := right.(StringValue); ok {
+				return BoolValue{Val: leftStr.Val > rightStr.Val}
+			}
+		}
 		return ErrorValue{Message: "Operands must be numbers", Line: expr.Line}
 	case GREATER_EQUAL:
 		if leftNum, ok := left.(NumberValue); ok {
@@ -194,6 +231,11 @@ func (e *Evaluator) VisitBinaryExpr(expr *Binary) Value {
 				return BoolValue{Val: leftNum.Val >= rightNum.Val}
 			}
 		}
+		if leftStr, ok := left.(StringValue); ok {
+			if rightStr, ok := right.(StringValue); ok {
+				return BoolValue{Val: leftStr.Val >= rightStr.Val}
+			}
+		}
 		return ErrorValue{Message: "Operands must be numbers", Line: expr.Line}
 	case EQUAL_EQUAL:
 		return BoolValue{Val: isEqual(left, right)}
@@ -231,6 +273,12 @@ func (e *Evaluator) VisitUnaryExpr(expr *Unary) Value {
 // VisitVariableExpr evaluates variable expressions
 func (e *Evaluator) VisitVariableExpr(expr *Variable) Value {
 	if value, ok := e.scope.lookup(expr.Name.Lexeme); ok {
+		if _, uninitialized := value.(uninitializedValue); uninitialized {
+			if e.strictVars {
+				return ErrorValue{Message: fmt.Sprintf("Uninitialized variable '%s'", expr.Name.Lexeme), Line: expr.Line}
+			}
+			return NilValue{}
+		}
 		return value
 	}
 	return ErrorValue{Message: fmt.Sprintf("Undefined variable '%s'", expr.Name.Lexeme), Line: expr.Line}
@@ -242,27 +290,23 @@ func (e *Evaluator) VisitPrintStatement(expr *PrintStatement) Value {
 	case ErrorValue:
 		return result
 	default:
-		_, err := fmt.Fprintf(e.output, "%s\n", formatValue(result))
+		_, err := fmt.Fprintf(e.output, "%s\n", formatValue(result, e.precision))
 		if err != nil {
-			return ErrorValue{Message: "Print failed"}
+			return ErrorValue{Message: "Print failed", Line: expr.Line}
 		}
 		return NilValue{}
 	}
 }
 
 func (e *Evaluator) VisitStatements(expr *Statements) Value {
-	var result Value = NilValue{}
-	for _, v := range expr.Exprs {
-		result = e.Evaluate(v)
-		switch result.(type) {
-		case ErrorValue:
-			return result
-		}
-	}
-	return result
+	return e.evalStatements(expr.Exprs)
 }
 
 func (e *Evaluator) VisitVarStatement(expr *VarStatement) Value {
+	if expr.Expression == nil {
+		e.scope.declare(expr.name)
+		return NilValue{}
+	}
 	result := e.Evaluate(expr.Expression)
 	switch result.(type) {
 	case ErrorValue:
@@ -285,6 +329,7 @@ func (e *Evaluator) VisitBlock(expr *Block) Value {
 }
 
 func (e *Evaluator) evalStatements(statements []Expr) Value {
+	e.hoistFunctions(statements)
 	var result Value = NilValue{}
 	for _, stmt := range statements {
 		result = e.Evaluate(stmt)
@@ -296,6 +341,17 @@ func (e *Evaluator) evalStatements(statements []Expr) Value {
 	return result
 }
 
+// hoistFunctions defines every function declared directly in statements
+// before any of them run, so functions can call each other regardless of
+// declaration order
+func (e *Evaluator) hoistFunctions(statements []Expr) {
+	for _, stmt := range statements {
+		if fun, ok := stmt.(*Fun); ok {
+			e.scope.define(fun.Name, FunValue{Val: *fun, Closure: e.scope})
+		}
+	}
+}
+
 func (e *Evaluator) VisitIfStatement(expr *IfStatement) Value {
 	conditionValue := e.Evaluate(expr.Condition)
 	if _, isError := conditionValue.(ErrorValue); isError {
@@ -312,6 +368,7 @@ func (e *Evaluator) VisitIfStatement(expr *IfStatement) Value {
 }
 
 func (e *Evaluator) VisitWhileStatement(expr *WhileStatement) Value {
+	var result Value = NilValue{}
 	for {
 		conditionValue := e.Evaluate(expr.Condition)
 		if _, isError := conditionValue.(ErrorValue); isError {
@@ -326,104 +383,122 @@ func (e *Evaluator) VisitWhileStatement(expr *WhileStatement) Value {
 		if _, isError := bodyResult.(ErrorValue); isError {
 			return bodyResult
 		}
+		result = bodyResult
 	}
 
-	return NilValue{}
+	return e.loopResult(result)
 }
 
 func (e *Evaluator) VisitForStatement(expr *ForStatement) Value {
+	// The initializer gets its own scope so loop variables don't leak
+	previousScope := e.scope
+	e.scope = NewScope(previousScope)
+	defer func() { e.scope = previousScope }()
+
+	var result Value = NilValue{}
 	if nil != expr.Initializer {
-		_ = e.Evaluate(expr.Initializer)
+		initValue := e.Evaluate(expr.Initializer)
+		if _, isError := initValue.(ErrorValue); isError {
+			return initValue
+		}
 	}
 	for {
+		// A missing condition loops forever
+		if nil != expr.Condition {
+			conditionValue := e.Evaluate(expr.Condition)
+			if _, isError := conditionValue.(ErrorValue); isError {
+				return conditionValue
+			}
 
-		conditionValue := e.Evaluate(expr.Condition)
-		if _, isError := conditionValue.(ErrorValue); isError {
-			return conditionValue
-		}
-
-		if !isTruthy(conditionValue) {
-			break
+			if !isTruthy(conditionValue) {
+				break
+			}
 		}
 
 		bodyResult := e.Evaluate(expr.Body)
 		if _, isError := bodyResult.(ErrorValue); isError {
 			return bodyResult
 		}
+		result = bodyResult
 		if nil != expr.Increment {
-			_ = e.Evaluate(expr.Increment)
+			incrementValue := e.Evaluate(expr.Increment)
+			if _, isError := incrementValue.(ErrorValue); isError {
+				return incrementValue
+			}
 		}
 	}
 
+	return e.loopResult(result)
+}
+
+// loopResult returns what a finished loop evaluates to given the value of
+// its last body run
+func (e *Evaluator) loopResult(last Value) Value {
+	if e.loopReturnsLast {
+		return last
+	}
 	return NilValue{}
 }
 
 func (e *Evaluator) VisitCallExpr(expr *Call) Value {
-	// Check if it's a variable reference to "clock"
-	if varExpr, ok := expr.Callee.(*Variable); ok && varExpr.Name.Lexeme == "clock" {
-		// Check that clock() is called with no arguments
-		if len(expr.Arguments) != 0 {
-			return ErrorValue{Message: "clock() takes no arguments", Line: expr.Line}
-		}
-
-		// Return current time in epoch seconds
-		epochSeconds := float64(time.Now().Unix())
-		return NumberValue{Val: epochSeconds}
-	} else if varExpr, ok := expr.Callee.(*Variable); ok {
-		lookup, ok := e.scope.lookup(varExpr.Name.Lexeme)
-		if !ok {
-			return ErrorValue{Message: "undefined function", Line: expr.Line}
-		}
-		if fv, ok := lookup.(FunValue); ok {
-			// Check argument count
-			if len(expr.Arguments) != len(fv.Val.Parameters) {
-				return ErrorValue{
-					Message: fmt.Sprintf("Expected %d arguments but got %d", len(fv.Val.Parameters), len(expr.Arguments)),
-					Line:    expr.Line,
-				}
-			}
-
-			// Evaluate arguments
-			argValues := make([]Value, len(expr.Arguments))
-			for i, arg := range expr.Arguments {
-				argValue := e.Evaluate(arg)
-				if _, isError := argValue.(ErrorValue); isError {
-					return argValue
-				}
-				argValues[i] = argValue
-			}
-
-			// Create new scope for function execution
-			previousScope := e.scope
-			e.scope = NewScope(previousScope)
+	callee := e.Evaluate(expr.Callee)
+	if _, isError := callee.(ErrorValue); isError {
+		return callee
+	}
 
-			// Bind parameters to arguments in the new scope
-			for i, paramName := range fv.Val.Parameters {
-				e.scope.define(paramName, argValues[i])
-			}
+	var arity int
+	switch fn := callee.(type) {
+	case FunValue:
+		arity = len(fn.Val.Parameters)
+	case NativeFunValue:
+		arity = fn.Arity
+	default:
+		return ErrorValue{Message: "cannot call a non-function", Line: expr.Line}
+	}
 
-			// Execute function body
-			result := e.evalStatements(fv.Val.Block.Statements)
+	// Check argument count
+	if len(expr.Arguments) != arity {
+		return ErrorValue{
+			Message: fmt.Sprintf("Expected %d arguments but got %d", arity, len(expr.Arguments)),
+			Line:    expr.Line,
+		}
+	}
 
-			// Restore previous scope
-			e.scope = previousScope
-			return result
-		} else {
-			return ErrorValue{Message: "cannot call a non-function", Line: expr.Line}
+	// Evaluate arguments
+	argValues := make([]Value, len(expr.Arguments))
+	for i, arg := range expr.Arguments {
+		argValue := e.Evaluate(arg)
+		if _, isError := argValue.(ErrorValue); isError {
+			return argValue
 		}
+		argValues[i] = argValue
 	}
 
-	// Evaluate the callee for other function calls
-	callee := e.Evaluate(expr.Callee)
-	if _, isError := callee.(ErrorValue); isError {
-		return callee
+	if native, ok := callee.(NativeFunValue); ok {
+		return native.Call(argValues, expr.Line)
+	}
+	fv := callee.(FunValue)
+
+	// Create new scope for function execution, enclosed by the
+	// scope the function was declared in
+	previousScope := e.scope
+	e.scope = NewScope(fv.Closure)
+
+	// Bind parameters to arguments in the new scope
+	for i, paramName := range fv.Val.Parameters {
+		e.scope.define(paramName, argValues[i])
 	}
 
-	// Any other function call is an error
-	return ErrorValue{Message: "Undefined function", Line: expr.Line}
+	// Execute function body
+	result := e.evalStatements(fv.Val.Block.Statements)
+
+	// Restore previous scope
+	e.scope = previousScope
+	return result
 }
+
 func (e *Evaluator) VisitFun(expr *Fun) Value {
-	val := FunValue{Val: *expr}
+	val := FunValue{Val: *expr, Closure: e.scope}
 	e.scope.define(expr.Name, val)
 	return val
 }
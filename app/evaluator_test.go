@@ -2,13 +2,14 @@ package main
 
 import (
 	"bytes"
+	"io"
 	"os"
 	"testing"
 
 	"gopkg.in/yaml.v3"
 )
 
-func evaluateToString(input string, output *bytes.Buffer) string {
+func evaluateToString(input string, output *bytes.Buffer, opts Options) string {
 	tokens, err := TokenizeString(input)
 	if err != nil {
 		return "Tokenization error: " + err.Error()
@@ -20,20 +21,21 @@ func evaluateToString(input string, output *bytes.Buffer) string {
 		return "Parse error: " + err.Error()
 	}
 
-	evaluator := NewEvaluator(NewScope(nil), output)
+	evaluator := opts.NewEvaluator(NewGlobalScope(), output)
 	result := evaluator.Evaluate(expr)
 	if ev, isErrVal := result.(ErrorValue); isErrVal {
 		return "Evaluation error: " + ev.Message
 	}
 
-	return formatValue(result)
+	return opts.Formatter.Format(result)
 }
 
 type EvaluatorTestCase struct {
-	Name           string `yaml:"name"`
-	Input          string `yaml:"input"`
-	Expected       string `yaml:"expected"`
-	ExpectedOutput string `yaml:"expectedOutput"`
+	Name           string   `yaml:"name"`
+	Input          string   `yaml:"input"`
+	Expected       string   `yaml:"expected"`
+	ExpectedOutput string   `yaml:"expectedOutput"`
+	Flags          []string `yaml:"flags"`
 }
 
 type EvaluatorTestSuite struct {
@@ -65,8 +67,13 @@ func TestEvaluatorCases(t *testing.T) {
 		tc := tc
 		t.Run(tc.Name, func(t *testing.T) {
 			t.Parallel()
+			opts, _, err := parseOptions("evaluate", tc.Flags, io.Discard)
+			if err != nil {
+				t.Fatalf("Test %s has invalid flags %v: %v", tc.Name, tc.Flags, err)
+			}
+
 			var output bytes.Buffer
-			result := evaluateToString(tc.Input, &output)
+			result := evaluateToString(tc.Input, &output, opts)
 
 			// Check the return value
 			if result != tc.Expected {
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Formatter renders a runtime value as text
+type Formatter interface {
+	Format(value Value) string
+}
+
+// HumanFormatter renders values the same way the print statement does.
+// Strings are shown without quotes unless QuoteStrings is set, in which
+// case they are quoted as in Lox source so "1" and 1 can be told apart.
+// Precision is the number of significant digits shown for numbers that are
+// not exact integers; zero shows the shortest form that reads back exactly.
+type HumanFormatter struct {
+	QuoteStrings bool
+	Precision    int
+}
+
+// Format renders value for people to read
+func (f HumanFormatter) Format(value Value) string {
+	if v, ok := value.(StringValue); ok && f.QuoteStrings {
+		return SourceFormatter{}.Format(v)
+	}
+	return formatValue(value, f.Precision)
+}
+
+// JSONFormatter renders values as JSON
+type JSONFormatter struct{}
+
+// Format renders value as a JSON document. Functions have no JSON form and
+// are rendered as the string "<fn name>".
+func (JSONFormatter) Format(value Value) string {
+	switch v := value.(type) {
+	case NilValue:
+		return "null"
+	case NumberValue:
+		// JSON has no representation for NaN or infinities
+		if math.IsNaN(v.Val) || math.IsInf(v.Val, 0) {
+			return "null"
+		}
+		return formatValue(v, 0)
+	case BoolValue:
+		return formatValue(v, 0)
+	case StringValue:
+		return jsonString(v.Val)
+	default:
+		return jsonString(formatValue(value, 0))
+	}
+}
+
+// jsonString quotes s as a JSON string without escaping HTML characters
+func jsonString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// SourceFormatter renders values as Lox source literals
+type SourceFormatter struct{}
+
+// Format renders value as a Lox expression that evaluates back to it.
+// Numbers are written out in full, since the scanner reads no exponents,
+// and NaN and infinities go through string_to_number. Functions have no
+// literal form and keep their <fn name> rendering, and Lox strings have no
+// escapes, so a string containing a double quote cannot be read back.
+func (SourceFormatter) Format(value Value) string {
+	switch v := value.(type) {
+	case StringValue:
+		return "\"" + v.Val + "\""
+	case NumberValue:
+		return formatNumberSource(v.Val)
+	default:
+		return formatValue(value, 0)
+	}
+}
+
+// formatNumberSource renders n as Lox source that evaluates to exactly n
+func formatNumberSource(n float64) string {
+	switch {
+	case math.IsNaN(n):
+		return `string_to_number("nan")`
+	case math.IsInf(n, 1):
+		return `string_to_number("inf")`
+	case math.IsInf(n, -1):
+		return `string_to_number("-inf")`
+	default:
+		// The shortest decimal that parses back to the same float
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+}
+
+// formatters maps the names accepted by --format to their formatter
+var formatters = map[string]Formatter{
+	"human":  HumanFormatter{},
+	"json":   JSONFormatter{},
+	"source": SourceFormatter{},
+}
+
+// NewFormatter returns the formatter registered under name
+func NewFormatter(name string) (Formatter, error) {
+	if formatter, ok := formatters[name]; ok {
+		return formatter, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (expected human, json or source)", name)
+}
+
+// maxPrecision is the largest --precision accepted. Seventeen significant
+// digits are enough to tell any two floats apart.
+const maxPrecision = 17
+
+// maxPlainInteger is the magnitude from which numbers switch to exponent
+// notation instead of printing every digit
+const maxPlainInteger = 1e21
+
+// formatNumber renders numbers as plain decimals, with no decimal point
+// for exact integers. Numbers that are not integers are rounded to
+// precision significant digits, or shown in the shortest form that reads
+// back exactly when precision is zero. Only magnitudes from maxPlainInteger
+// up and infinities use exponent form. NaN is rendered as "nan".
+func formatNumber(n float64, precision int) string {
+	if math.IsNaN(n) {
+		return "nan"
+	}
+	if precision > 0 && n != math.Trunc(n) {
+		// The exponent form counts significant digits; reading it back
+		// leaves the rounded value to be printed like any other
+		n, _ = strconv.ParseFloat(strconv.FormatFloat(n, 'e', precision-1, 64), 64)
+	}
+	if math.IsInf(n, 0) || math.Abs(n) >= maxPlainInteger {
+		return strconv.FormatFloat(n, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
+
+// formatNumberLiteral renders a number the way the tokenize and parse
+// commands show literals: in the shortest form, with integers keeping a
+// trailing ".0" (e.g. 5.0)
+func formatNumberLiteral(n float64) string {
+	formatted := formatNumber(n, 0)
+	// Exponents, NaN and Inf already read as floats
+	if !math.IsNaN(n) && !math.IsInf(n, 0) && !strings.ContainsAny(formatted, ".e") {
+		formatted += ".0"
+	}
+	return formatted
+}
+
+// formatValue renders value as the print statement does, with numbers
+// formatted to precision significant digits as by formatNumber
+func formatValue(value Value, precision int) string {
+	switch v := value.(type) {
+	case NilValue:
+		return "nil"
+	case NumberValue:
+		return formatNumber(v.Val, precision)
+	case StringValue:
+		return v.Val
+	case BoolValue:
+		if v.Val {
+			return "true"
+		}
+		return "false"
+	case FunValue:
+		return fmt.Sprintf("<fn %s>", v.Val.Name)
+	case NativeFunValue:
+		return "<native fn>"
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
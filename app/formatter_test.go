@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io"
+	"math"
+	"testing"
+)
+
+func TestSourceFormatterRoundTrip(t *testing.T) {
+	values := map[string]Value{
+		"Nil":              NilValue{},
+		"True":             BoolValue{Val: true},
+		"Integer":          NumberValue{Val: 42},
+		"Negative":         NumberValue{Val: -2.5},
+		"NegativeZero":     NumberValue{Val: math.Copysign(0, -1)},
+		"FloatNoise":       NumberValue{Val: 0.1 + 0.2},
+		"Large":            NumberValue{Val: 1e21},
+		"Tiny":             NumberValue{Val: 1.5e-7},
+		"MaxFloat":         NumberValue{Val: math.MaxFloat64},
+		"NaN":              NumberValue{Val: math.NaN()},
+		"Infinity":         NumberValue{Val: math.Inf(1)},
+		"NegativeInfinity": NumberValue{Val: math.Inf(-1)},
+		"String":           StringValue{Val: "multi\nline"},
+	}
+
+	for name, value := range values {
+		t.Run(name, func(t *testing.T) {
+			source := SourceFormatter{}.Format(value)
+			tokens, err := TokenizeString(source)
+			if err != nil {
+				t.Fatalf("Tokenizing %q failed: %v", source, err)
+			}
+			expr, err := NewParser(tokens).Parse()
+			if err != nil {
+				t.Fatalf("Parsing %q failed: %v", source, err)
+			}
+			result := NewEvaluator(NewGlobalScope(), io.Discard).Evaluate(expr)
+			if !sameValue(result, value) {
+				t.Errorf("%q evaluated to %#v, expected %#v", source, result, value)
+			}
+		})
+	}
+}
+
+// sameValue compares values exactly, treating NaN as equal to itself and
+// telling 0 and -0 apart
+func sameValue(a, b Value) bool {
+	if x, ok := a.(NumberValue); ok {
+		if y, ok := b.(NumberValue); ok {
+			if math.IsNaN(x.Val) || math.IsNaN(y.Val) {
+				return math.IsNaN(x.Val) && math.IsNaN(y.Val)
+			}
+			return x.Val == y.Val && math.Signbit(x.Val) == math.Signbit(y.Val)
+		}
+	}
+	return a == b
+}
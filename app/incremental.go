@@ -0,0 +1,107 @@
+package main
+
+// IncrementalParse parses newSrc given old, the program parsed from oldSrc.
+// Top-level statements the edit did not touch are reused as-is rather than
+// parsed again, so they keep their identity in the returned tree; only the
+// statements around the edit are reparsed. The result is the same tree
+// Parse would build from newSrc.
+//
+// A statement is reused from the front when its tokens are unchanged and
+// the token after it is of the same kind, since the parser looks one token
+// ahead to end it. Once reparsing reaches the start of an old statement
+// lying entirely in the unchanged tail, everything from there on parses as
+// before and is reused.
+// Lines are part of the comparison, so an edit that adds or removes lines
+// reparses the statements after it.
+func IncrementalParse(old Expr, oldSrc, newSrc string) (Expr, error) {
+	newTokens, err := TokenizeString(newSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	oldProgram, ok := old.(*Statements)
+	if !ok || len(oldProgram.ends) != len(oldProgram.Exprs) {
+		return NewParser(newTokens).Parse()
+	}
+	oldTokens, err := TokenizeString(oldSrc)
+	if err != nil || oldProgram.ends[len(oldProgram.ends)-1] >= len(oldTokens) {
+		return NewParser(newTokens).Parse()
+	}
+
+	prefix, suffix := commonTokens(oldTokens, newTokens)
+	shift := len(newTokens) - len(oldTokens)
+
+	// Old statements in the unchanged tail, keyed by where they start in
+	// the new tokens
+	tailStarts := make(map[int]int)
+	for i := 1; i < len(oldProgram.Exprs); i++ {
+		if start := oldProgram.ends[i-1]; start >= len(oldTokens)-suffix {
+			tailStarts[start+shift] = i
+		}
+	}
+
+	p := NewParser(newTokens)
+	program := &Statements{Line: oldProgram.Line}
+	for i, end := range oldProgram.ends {
+		// The token after a statement only decides where it ends by its kind
+		if end > prefix || end == prefix && !sameKind(oldTokens[end], newTokens[end]) {
+			break
+		}
+		program.Exprs = append(program.Exprs, oldProgram.Exprs[i])
+		program.ends = append(program.ends, end)
+		p.current = end
+	}
+
+	// Without a reused first statement, parse it as statements() does
+	if len(program.Exprs) == 0 {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		program.Line = p.previous().Line
+		program.Exprs = append(program.Exprs, expr)
+		_ = p.match(SEMICOLON)
+		program.ends = append(program.ends, p.current)
+	}
+
+	for {
+		if i, ok := tailStarts[p.current]; ok {
+			program.Exprs = append(program.Exprs, oldProgram.Exprs[i:]...)
+			for _, end := range oldProgram.ends[i:] {
+				program.ends = append(program.ends, end+shift)
+			}
+			break
+		}
+
+		expr, err := p.expression()
+		if err != nil {
+			break
+		}
+		program.Exprs = append(program.Exprs, expr)
+		_ = p.match(SEMICOLON)
+		program.ends = append(program.ends, p.current)
+	}
+
+	if len(program.Exprs) == 1 {
+		return program.Exprs[0], nil
+	}
+	return program, nil
+}
+
+// commonTokens returns how many tokens old and new share at the start and
+// at the end. The two may overlap when the edit repeats nearby tokens.
+func commonTokens(old, new []Token) (prefix, suffix int) {
+	limit := min(len(old), len(new))
+	for prefix < limit && old[prefix] == new[prefix] {
+		prefix++
+	}
+	for suffix < limit && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+	return prefix, suffix
+}
+
+// sameKind reports whether two tokens differ at most in their line
+func sameKind(a, b Token) bool {
+	return a.Type == b.Type && a.Lexeme == b.Lexeme && a.Literal == b.Literal
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIncrementalParse(t *testing.T) {
+	testCases := []struct {
+		name   string
+		oldSrc string
+		newSrc string
+		// reused lists the indexes of new top-level statements expected to be
+		// the old subtrees themselves
+		reused []int
+	}{
+		{
+			name:   "EditMiddleStatement",
+			oldSrc: "var a = 1;\nprint a + 2;\nprint a * 3;",
+			newSrc: "var a = 1;\nprint a - 20;\nprint a * 3;",
+			reused: []int{0, 2},
+		},
+		{
+			name:   "EditFirstStatement",
+			oldSrc: "print 1; print 2; print 3;",
+			newSrc: "print 10; print 2; print 3;",
+			reused: []int{1, 2},
+		},
+		{
+			name:   "EditLastStatement",
+			oldSrc: "print 1; print 2; print 3;",
+			newSrc: "print 1; print 2; print 30;",
+			reused: []int{0, 1},
+		},
+		{
+			name:   "InsertStatement",
+			oldSrc: "print 1; print 3;",
+			newSrc: "print 1; print 2; print 3;",
+			reused: []int{0, 2},
+		},
+		{
+			name:   "LineShiftReparsesFollowing",
+			oldSrc: "print 1;\nprint 2;\nprint 3;",
+			newSrc: "print 1;\n\nprint 2;\nprint 3;",
+			reused: []int{0},
+		},
+		{
+			name:   "EditJoinsStatements",
+			oldSrc: "a\nb\nprint 3;",
+			newSrc: "a +\nb\nprint 3;",
+			reused: []int{1},
+		},
+		{
+			name:   "EditBlockBody",
+			oldSrc: "fun f(x) { print x; }\n{ print 1; }\nf(2);",
+			newSrc: "fun f(x) { print x; }\n{ print 1; print 1; }\nf(2);",
+			reused: []int{0, 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			old := mustParse(t, tc.oldSrc)
+			result, err := IncrementalParse(old, tc.oldSrc, tc.newSrc)
+			if err != nil {
+				t.Fatalf("IncrementalParse failed: %v", err)
+			}
+
+			if expected := mustParse(t, tc.newSrc); !reflect.DeepEqual(result, expected) {
+				printer := &AstPrinter{}
+				t.Fatalf("Expected the tree Parse builds:\n%s\nGot:\n%s", printer.Print(expected), printer.Print(result))
+			}
+
+			var reused []int
+			for i, stmt := range result.(*Statements).Exprs {
+				for _, oldStmt := range old.(*Statements).Exprs {
+					if stmt == oldStmt {
+						reused = append(reused, i)
+					}
+				}
+			}
+			if !reflect.DeepEqual(reused, tc.reused) {
+				t.Errorf("Expected statements %v to be reused, got %v", tc.reused, reused)
+			}
+		})
+	}
+}
+
+func TestIncrementalParseReportsErrors(t *testing.T) {
+	old := mustParse(t, "print 1; print 2;")
+	if _, err := IncrementalParse(old, "print 1; print 2;", "print ; print 2;"); err == nil {
+		t.Error("Expected a parse error for an invalid first statement")
+	}
+}
+
+func mustParse(t *testing.T, src string) Expr {
+	t.Helper()
+	tokens, err := TokenizeString(src)
+	if err != nil {
+		t.Fatalf("Tokenization error: %v", err)
+	}
+	expr, err := NewParser(tokens).Parse()
+	if err != nil {
+		t.Fatalf("Parse error: %v", err)
+	}
+	return expr
+}
@@ -2,9 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
-	
+
 	"github.com/chzyer/readline"
 )
 
@@ -15,122 +16,133 @@ func main() {
 	}
 
 	command := os.Args[1]
-	
+
 	// Check if command is repl
 	if command == "repl" {
 		handleRepl()
 		return
 	}
-	
-	// For other commands, require a filename
-	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh <command> <filename>")
+
+	// For other commands, require a filename after any flags
+	opts, args, err := parseOptions(command, os.Args[2:], os.Stderr)
+	if err != nil {
+		os.Exit(1)
+	}
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ./your_program.sh <command> [flags] <filename>")
 		os.Exit(1)
 	}
-	
-	filename := os.Args[2]
+
+	filename := args[0]
 
 	switch command {
 	case "tokenize":
-		handleTokenize(filename)
+		os.Exit(handleTokenize(filename, opts, os.Stdout, os.Stderr))
 	case "parse":
-		handleParse(filename)
+		os.Exit(handleParse(filename, opts, os.Stdout, os.Stderr))
 	case "evaluate":
-		handleEvaluate(filename, true)
+		os.Exit(handleEvaluate(filename, opts, true, os.Stdout, os.Stderr))
 	case "run":
-		handleEvaluate(filename, false)
+		os.Exit(handleEvaluate(filename, opts, false, os.Stdout, os.Stderr))
+	case "watch":
+		NewWatcher(filename, opts, os.Stdout, os.Stderr).Run()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
 		os.Exit(1)
 	}
 }
 
-func handleTokenize(filename string) {
+// The handlers below run one command and return the process exit code
+
+func handleTokenize(filename string, opts Options, stdout, stderr io.Writer) int {
 	tokenized, tokenizeErr := TokenizeFile(filename)
 
 	for _, tok := range tokenized {
-		_, err := fmt.Fprintf(os.Stdout, "%s\n", tok.String())
+		_, err := fmt.Fprintf(stdout, "%s\n", tok.String())
 		if err != nil {
-			os.Exit(1)
+			return 1
 		}
 	}
 	if tokenizeErr != nil {
-		os.Exit(65)
+		return opts.ExitParseError
 	}
+	return 0
 }
 
-func handleParse(filename string) {
-	// Tokenize the file first
-	tokens, tokenizeErr := TokenizeFile(filename)
-	if tokenizeErr != nil {
-		fmt.Fprintf(os.Stderr, "Tokenization error: %v\n", tokenizeErr)
-		os.Exit(65)
+// loadProgram tokenizes and parses filename. With --cache, an unchanged
+// file reuses its cached AST; without a user cache directory the cache is
+// skipped.
+func loadProgram(filename string, opts Options) (Expr, error) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Tokenization error: %w", err)
 	}
+	if opts.Cache {
+		if dir, err := DefaultASTCacheDir(); err == nil {
+			return ASTCache{Dir: dir}.Parse(source, parseSource)
+		}
+	}
+	return parseSource(source)
+}
+
+// parseSource tokenizes and parses source, prefixing errors with the stage
+// that reported them
+func parseSource(source []byte) (Expr, error) {
+	tokens, err := TokenizeString(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("Tokenization error: %w", err)
+	}
+	expr, err := NewParser(tokens).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("Parse error: %w", err)
+	}
+	return expr, nil
+}
 
-	// Parse the tokens into an AST
-	parser := NewParser(tokens)
-	expr, parseErr := parser.Parse()
-	if parseErr != nil {
-		fmt.Fprintf(os.Stderr, "Parse error: %v\n", parseErr)
-		os.Exit(65)
+func handleParse(filename string, opts Options, stdout, stderr io.Writer) int {
+	expr, err := loadProgram(filename, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return opts.ExitParseError
 	}
 
 	// Print the AST as S-expression
 	printer := &AstPrinter{}
-	result := printer.Print(expr)
-	fmt.Println(result)
+	result := printer.Print(opts.Prepare(expr))
+	fmt.Fprintln(stdout, result)
+	return 0
 }
 
-func handleEvaluate(filename string, printResult bool) {
-	// Tokenize the file first
-	tokens, tokenizeErr := TokenizeFile(filename)
-	if tokenizeErr != nil {
-		fmt.Fprintf(os.Stderr, "Tokenization error: %v\n", tokenizeErr)
-		os.Exit(65)
+func handleEvaluate(filename string, opts Options, printResult bool, stdout, stderr io.Writer) int {
+	expr, err := loadProgram(filename, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return opts.ExitParseError
 	}
 
-	// Parse the tokens into an AST
-	parser := NewParser(tokens)
-	expr, parseErr := parser.Parse()
-	if parseErr != nil {
-		fmt.Fprintf(os.Stderr, "Parse error: %v\n", parseErr)
-		os.Exit(65)
+	// Report undefined variables before running anything. These were
+	// runtime errors before the resolver existed, so keep their exit code.
+	if resolveErrs := NewResolver().Resolve(expr); len(resolveErrs) > 0 {
+		for _, resolveErr := range resolveErrs {
+			fmt.Fprintf(stderr, "%v\n", resolveErr)
+		}
+		return opts.ExitRuntimeError
 	}
 
 	// Evaluate the expression
-	evaluator := NewEvaluator(NewScope(nil), os.Stdout)
-	result := evaluator.Evaluate(expr)
+	evaluator := opts.NewEvaluator(NewGlobalScope(), stdout)
+	result := evaluator.Evaluate(opts.Prepare(expr))
 	switch result.(type) {
 	case ErrorValue:
 		errorText := fmt.Errorf("[Line %d]\nError: %s", result.(ErrorValue).Line, result.(ErrorValue).Message)
-		fmt.Fprintf(os.Stderr, "%v\n", errorText)
-		os.Exit(70)
+		fmt.Fprintf(stderr, "%v\n", errorText)
+		return opts.ExitRuntimeError
 	default:
 		if printResult {
-			fmt.Println(formatValue(result))
-		}
-	}
-
-}
-
-func formatValue(value Value) string {
-	switch v := value.(type) {
-	case NilValue:
-		return "nil"
-	case NumberValue:
-		return fmt.Sprintf("%g", v.Val)
-	case StringValue:
-		return v.Val
-	case BoolValue:
-		if v.Val {
-			return "true"
+			fmt.Fprintln(stdout, opts.Formatter.Format(result))
 		}
-		return "false"
-	case FunValue:
-		return fmt.Sprintf("<fn %s>", v.Val.Name)
-	default:
-		return fmt.Sprintf("%v", value)
 	}
+	return 0
 }
 
 func handleRepl() {
@@ -143,37 +155,37 @@ func handleRepl() {
 	defer rl.Close()
 
 	// Create a persistent scope that will be reused across REPL commands
-	scope := NewScope(nil)
-	
+	scope := NewGlobalScope()
+
 	fmt.Println("Welcome to Lox REPL! Type 'exit' to quit.")
-	
+
 	for {
 		// Read line from user
 		line, err := rl.Readline()
 		if err != nil { // io.EOF or other error
 			break
 		}
-		
+
 		// Handle exit command
 		line = strings.TrimSpace(line)
 		if line == "exit" || line == "quit" {
 			break
 		}
-		
+
 		// Skip empty lines
 		if line == "" {
 			continue
 		}
-		
+
 		// Tokenize the input
 		tokens, tokenizeErr := TokenizeString(line)
-		
+
 		// Print tokenization errors but continue
 		if tokenizeErr != nil {
 			fmt.Fprintf(os.Stderr, "Tokenization error: %v\n", tokenizeErr)
 			continue
 		}
-		
+
 		// Parse the tokens
 		parser := NewParser(tokens)
 		expr, parseErr := parser.Parse()
@@ -181,22 +193,22 @@ func handleRepl() {
 			fmt.Fprintf(os.Stderr, "Parse error: %v\n", parseErr)
 			continue
 		}
-		
+
 		// Evaluate the expression with the persistent scope
 		evaluator := NewEvaluator(scope, os.Stdout)
 		result := evaluator.Evaluate(expr)
-		
+
 		// Handle evaluation errors
 		if errVal, isError := result.(ErrorValue); isError {
 			fmt.Fprintf(os.Stderr, "Runtime error: %s\n", errVal.Message)
 			continue
 		}
-		
+
 		// Print the result only if it's not nil (statements return nil)
 		if _, isNil := result.(NilValue); !isNil {
-			fmt.Println(formatValue(result))
+			fmt.Println(formatValue(result, 0))
 		}
 	}
-	
+
 	fmt.Println("Goodbye!")
 }
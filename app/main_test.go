@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// writeProgram stores source in a temporary .lox file and returns its path
+func writeProgram(t *testing.T, source string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "program.lox")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHandlerExitCodes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		command  string
+		flags    []string
+		source   string
+		expected int
+	}{
+		{"ParseErrorDefault", "evaluate", nil, "print ;", 65},
+		{"RuntimeErrorDefault", "evaluate", nil, "-\"a\"", 70},
+		{"UndefinedVariableDefault", "run", nil, "print a;", 70},
+		{"ParseErrorOverridden", "evaluate", []string{"--exit-parse-error=2"}, "print ;", 2},
+		{"RuntimeErrorOverridden", "run", []string{"--exit-runtime-error=3"}, "-\"a\"", 3},
+		{"UndefinedVariableOverridden", "run", []string{"--exit-runtime-error=3"}, "print a;", 3},
+		{"ParseCommandOverridden", "parse", []string{"--exit-parse-error=4"}, "(1", 4},
+		{"TokenizeCommandOverridden", "tokenize", []string{"--exit-parse-error=5"}, "@", 5},
+		{"SuccessUnaffected", "evaluate", []string{"--exit-runtime-error=3"}, "1 + 2", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts, _, err := parseOptions(tc.command, tc.flags, io.Discard)
+			if err != nil {
+				t.Fatalf("parseOptions failed: %v", err)
+			}
+			if code := runHandler(tc.command, writeProgram(t, tc.source), opts); code != tc.expected {
+				t.Errorf("Expected exit code %d, got %d", tc.expected, code)
+			}
+		})
+	}
+}
+
+func TestUndefinedVariableReportedBeforeRunning(t *testing.T) {
+	opts, _, err := parseOptions("run", nil, io.Discard)
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+
+	// The resolver stops the program before its first print runs, and
+	// reports the error as the evaluator would
+	var stdout, stderr bytes.Buffer
+	filename := writeProgram(t, "print \"before\";\nprint undefinedVar;")
+	if code := handleEvaluate(filename, opts, false, &stdout, &stderr); code != 70 {
+		t.Errorf("Expected exit code 70, got %d", code)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no output, got %q", stdout.String())
+	}
+	if expected := "[Line 2]\nError: Undefined variable 'undefinedVar'\n"; stderr.String() != expected {
+		t.Errorf("Expected stderr %q, got %q", expected, stderr.String())
+	}
+}
+
+func TestExitCodesFromEnvironment(t *testing.T) {
+	t.Setenv("LOX_EXIT_PARSE_ERROR", "11")
+	t.Setenv("LOX_EXIT_RUNTIME_ERROR", "12")
+
+	opts, _, err := parseOptions("evaluate", nil, io.Discard)
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+	if code := runHandler("evaluate", writeProgram(t, "print ;"), opts); code != 11 {
+		t.Errorf("Expected parse error exit code 11, got %d", code)
+	}
+	if code := runHandler("evaluate", writeProgram(t, "-\"a\""), opts); code != 12 {
+		t.Errorf("Expected runtime error exit code 12, got %d", code)
+	}
+
+	// Flags take precedence over the environment
+	opts, _, err = parseOptions("evaluate", []string{"--exit-parse-error=13"}, io.Discard)
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+	if code := runHandler("evaluate", writeProgram(t, "print ;"), opts); code != 13 {
+		t.Errorf("Expected parse error exit code 13, got %d", code)
+	}
+}
+
+func TestExitCodeFromEnvironmentMustBeInteger(t *testing.T) {
+	t.Setenv("LOX_EXIT_RUNTIME_ERROR", "seventy")
+
+	if _, _, err := parseOptions("evaluate", nil, io.Discard); err == nil {
+		t.Error("Expected an error for a non-integer exit code")
+	}
+}
+
+func TestExitCodesMustBeInRange(t *testing.T) {
+	for _, code := range []string{"0", "-1", "256"} {
+		for _, flag := range []string{"--exit-parse-error", "--exit-runtime-error"} {
+			if _, _, err := parseOptions("evaluate", []string{flag + "=" + code}, io.Discard); err == nil {
+				t.Errorf("Expected an error for %s=%s", flag, code)
+			}
+		}
+		for _, name := range []string{"LOX_EXIT_PARSE_ERROR", "LOX_EXIT_RUNTIME_ERROR"} {
+			t.Run(name+"="+code, func(t *testing.T) {
+				t.Setenv(name, code)
+				if _, _, err := parseOptions("evaluate", nil, io.Discard); err == nil {
+					t.Errorf("Expected an error for %s=%s", name, code)
+				}
+			})
+		}
+	}
+
+	for _, code := range []string{"1", "255"} {
+		opts, _, err := parseOptions("evaluate", []string{"--exit-runtime-error=" + code}, io.Discard)
+		if err != nil {
+			t.Fatalf("parseOptions failed for %s: %v", code, err)
+		}
+		if got := strconv.Itoa(opts.ExitRuntimeError); got != code {
+			t.Errorf("Expected exit code %s, got %s", code, got)
+		}
+	}
+}
+
+func TestPrecisionMustBeInRange(t *testing.T) {
+	for _, value := range []string{"0", "-1", "18", "many"} {
+		if _, _, err := parseOptions("evaluate", []string{"--precision=" + value}, io.Discard); err == nil {
+			t.Errorf("Expected an error for --precision=%s", value)
+		}
+	}
+}
+
+// runHandler runs the handler for command, discarding its output
+func runHandler(command, filename string, opts Options) int {
+	var stdout, stderr bytes.Buffer
+	switch command {
+	case "tokenize":
+		return handleTokenize(filename, opts, &stdout, &stderr)
+	case "parse":
+		return handleParse(filename, opts, &stdout, &stderr)
+	default:
+		return handleEvaluate(filename, opts, command == "evaluate", &stdout, &stderr)
+	}
+}
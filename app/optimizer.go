@@ -0,0 +1,285 @@
+package main
+
+import (
+	"io"
+)
+
+// Optimizer rewrites an AST into an equivalent one by folding operators
+// applied to literals, propagating variables bound to literals and dropping
+// branches that a literal condition makes unreachable.
+//
+// Propagation is deliberately conservative: a variable is only replaced by
+// its value when it is declared exactly once in the whole program, never
+// assigned, and read in the scope of its declaration outside any function
+// body. Anything else is left for the evaluator.
+type Optimizer struct {
+	// scopes maps names declared in each enclosing scope to their literal
+	// value, or to nil when the declaration is not a propagatable constant
+	scopes       []map[string]Value
+	declarations map[string]int
+	assigned     map[string]bool
+}
+
+// NewOptimizer creates an optimizer with an empty global scope
+func NewOptimizer() *Optimizer {
+	return &Optimizer{
+		scopes:       []map[string]Value{make(map[string]Value)},
+		declarations: make(map[string]int),
+		assigned:     make(map[string]bool),
+	}
+}
+
+// Optimize returns an optimized copy of expr; expr itself is not modified
+func (o *Optimizer) Optimize(expr Expr) Expr {
+	o.scan(expr)
+	return o.optimize(expr)
+}
+
+// scan records how often each name is declared and which names are assigned
+func (o *Optimizer) scan(exprs ...Expr) {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case *Binary:
+			if variable, ok := e.Left.(*Variable); ok && e.Operator.Type == EQUAL {
+				o.assigned[variable.Name.Lexeme] = true
+			}
+			o.scan(e.Left, e.Right)
+		case *Grouping:
+			o.scan(e.Expression)
+		case *Unary:
+			o.scan(e.Right)
+		case *PrintStatement:
+			o.scan(e.Expression)
+		case *Statements:
+			o.scan(e.Exprs...)
+		case *VarStatement:
+			o.declarations[e.name]++
+			o.scan(e.Expression)
+		case *Block:
+			o.scan(e.Statements...)
+		case *IfStatement:
+			o.scan(e.Condition, e.ThenBranch, e.ElseBranch)
+		case *WhileStatement:
+			o.scan(e.Condition, e.Body)
+		case *ForStatement:
+			o.scan(e.Initializer, e.Condition, e.Increment, e.Body)
+		case *Call:
+			o.scan(e.Callee)
+			o.scan(e.Arguments...)
+		case *Fun:
+			o.declarations[e.Name]++
+			o.scan(e.Block.Statements...)
+		}
+	}
+}
+
+func (o *Optimizer) optimize(expr Expr) Expr {
+	switch e := expr.(type) {
+	case *Binary:
+		return o.optimizeBinary(e)
+	case *Grouping:
+		inner := o.optimize(e.Expression)
+		if literal, ok := inner.(*Literal); ok {
+			return literal
+		}
+		return &Grouping{Expression: inner, Line: e.Line}
+	case *Unary:
+		right := o.optimize(e.Right)
+		folded := &Unary{Operator: e.Operator, Right: right, Line: e.Line}
+		if _, ok := right.(*Literal); ok {
+			return foldConstant(folded, e.Line)
+		}
+		return folded
+	case *Variable:
+		if value, ok := o.constant(e.Name.Lexeme); ok {
+			return &Literal{Value: value, Line: e.Line}
+		}
+		return e
+	case *PrintStatement:
+		return &PrintStatement{Expression: o.optimize(e.Expression), Line: e.Line}
+	case *Statements:
+		return &Statements{Exprs: o.optimizeAll(e.Exprs), Line: e.Line}
+	case *VarStatement:
+		var initializer Expr
+		if e.Expression != nil {
+			initializer = o.optimize(e.Expression)
+		}
+		o.declare(e.name, initializer)
+		return &VarStatement{name: e.name, Expression: initializer, Line: e.Line}
+	case *Block:
+		o.beginScope()
+		defer o.endScope()
+		return &Block{Statements: o.optimizeAll(e.Statements), Line: e.Line}
+	case *IfStatement:
+		return o.optimizeIf(e)
+	case *WhileStatement:
+		condition := o.optimize(e.Condition)
+		// A loop whose condition starts out false never runs its body
+		if literal, ok := condition.(*Literal); ok && !isTruthy(literal.Value) {
+			return &Literal{Value: NilValue{}, Line: e.Line}
+		}
+		return &WhileStatement{
+			Condition: condition,
+			Body:      o.optimizeBranch(e.Body),
+			Line:      e.Line,
+		}
+	case *ForStatement:
+		o.beginScope()
+		defer o.endScope()
+		return &ForStatement{
+			Initializer: o.optimize(e.Initializer),
+			Condition:   o.optimize(e.Condition),
+			Increment:   o.optimize(e.Increment),
+			Body:        o.optimizeBranch(e.Body),
+			Line:        e.Line,
+		}
+	case *Call:
+		return &Call{Callee: o.optimize(e.Callee), Arguments: o.optimizeAll(e.Arguments), Line: e.Line}
+	case *Fun:
+		o.declare(e.Name, nil)
+		return o.optimizeFun(e)
+	default:
+		return expr
+	}
+}
+
+func (o *Optimizer) optimizeBinary(expr *Binary) Expr {
+	if expr.Operator.Type == EQUAL {
+		return &Binary{Left: expr.Left, Operator: expr.Operator, Right: o.optimize(expr.Right), Line: expr.Line}
+	}
+
+	left := o.optimize(expr.Left)
+	right := o.optimize(expr.Right)
+
+	// A literal left operand decides and/or on its own
+	if literal, ok := left.(*Literal); ok {
+		switch expr.Operator.Type {
+		case OR:
+			if isTruthy(literal.Value) {
+				return literal
+			}
+			return right
+		case AND:
+			if !isTruthy(literal.Value) {
+				return literal
+			}
+			return right
+		}
+	}
+
+	folded := &Binary{Left: left, Operator: expr.Operator, Right: right, Line: expr.Line}
+	_, leftIsLiteral := left.(*Literal)
+	_, rightIsLiteral := right.(*Literal)
+	if leftIsLiteral && rightIsLiteral {
+		return foldConstant(folded, expr.Line)
+	}
+	return folded
+}
+
+// optimizeIf drops the branch a literal condition can never take. The
+// taken branch runs exactly once in the enclosing scope, so it replaces the
+// if and is optimized as straight-line code.
+func (o *Optimizer) optimizeIf(expr *IfStatement) Expr {
+	condition := o.optimize(expr.Condition)
+	literal, ok := condition.(*Literal)
+	if !ok {
+		return &IfStatement{
+			Condition:  condition,
+			ThenBranch: o.optimizeBranch(expr.ThenBranch),
+			ElseBranch: o.optimizeBranch(expr.ElseBranch),
+			Line:       expr.Line,
+		}
+	}
+
+	taken := expr.ElseBranch
+	if isTruthy(literal.Value) {
+		taken = expr.ThenBranch
+	}
+	if taken == nil {
+		return &Literal{Value: NilValue{}, Line: expr.Line}
+	}
+	if _, isFun := taken.(*Fun); isFun {
+		// Unwrapped into a statement list, the function would be hoisted
+		return &IfStatement{
+			Condition:  &Literal{Value: BoolValue{Val: true}, Line: literal.Line},
+			ThenBranch: o.optimize(taken),
+			Line:       expr.Line,
+		}
+	}
+	return o.optimize(taken)
+}
+
+// optimizeBranch optimizes code that may run any number of times, including
+// zero, so declarations in it must not be assumed to have happened afterwards
+func (o *Optimizer) optimizeBranch(expr Expr) Expr {
+	o.beginScope()
+	defer o.endScope()
+	return o.optimize(expr)
+}
+
+// optimizeFun optimizes a function body without outer constants, since the
+// body may run before later declarations in the enclosing scope
+func (o *Optimizer) optimizeFun(fun *Fun) Expr {
+	outer := o.scopes
+	o.scopes = []map[string]Value{make(map[string]Value)}
+	for _, param := range fun.Parameters {
+		o.declare(param, nil)
+	}
+	statements := o.optimizeAll(fun.Block.Statements)
+	o.scopes = outer
+
+	return &Fun{
+		Name:       fun.Name,
+		Parameters: fun.Parameters,
+		Block:      Block{Statements: statements, Line: fun.Block.Line},
+		Line:       fun.Line,
+	}
+}
+
+func (o *Optimizer) optimizeAll(exprs []Expr) []Expr {
+	var optimized []Expr
+	for _, expr := range exprs {
+		optimized = append(optimized, o.optimize(expr))
+	}
+	return optimized
+}
+
+func (o *Optimizer) beginScope() {
+	o.scopes = append(o.scopes, make(map[string]Value))
+}
+
+func (o *Optimizer) endScope() {
+	o.scopes = o.scopes[:len(o.scopes)-1]
+}
+
+// declare records name in the current scope, as a constant when its
+// initializer is a literal and the name is never redeclared or assigned
+func (o *Optimizer) declare(name string, initializer Expr) {
+	var value Value
+	if literal, ok := initializer.(*Literal); ok && o.declarations[name] == 1 && !o.assigned[name] {
+		value = literal.Value
+	}
+	o.scopes[len(o.scopes)-1][name] = value
+}
+
+// constant returns the literal value bound to name in the nearest scope
+// declaring it, if that declaration is a propagatable constant
+func (o *Optimizer) constant(name string) (Value, bool) {
+	for i := len(o.scopes) - 1; i >= 0; i-- {
+		if value, declared := o.scopes[i][name]; declared {
+			return value, value != nil
+		}
+	}
+	return nil, false
+}
+
+// foldConstant evaluates an operator whose operands are all literals. The
+// evaluator does the work so folding always agrees with runtime semantics;
+// operations that fail at runtime are left unfolded to report the error then.
+func foldConstant(expr Expr, line uint) Expr {
+	value := NewEvaluator(NewScope(nil), io.Discard).Evaluate(expr)
+	if _, isError := value.(ErrorValue); isError {
+		return expr
+	}
+	return &Literal{Value: value, Line: line}
+}
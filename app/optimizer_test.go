@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func optimizeToString(input string) string {
+	tokens, err := TokenizeString(input)
+	if err != nil {
+		return "Tokenization error: " + err.Error()
+	}
+
+	parser := NewParser(tokens)
+	expr, err := parser.Parse()
+	if err != nil {
+		return "Parse error: " + err.Error()
+	}
+
+	printer := &AstPrinter{}
+	return printer.Print(NewOptimizer().Optimize(expr))
+}
+
+type OptimizerTestCase struct {
+	Name     string `yaml:"name"`
+	Input    string `yaml:"input"`
+	Expected string `yaml:"expected"`
+}
+
+type OptimizerTestSuite struct {
+	Tests []OptimizerTestCase `yaml:"optimizer_tests"`
+}
+
+func loadOptimizerTests() ([]OptimizerTestCase, error) {
+	data, err := os.ReadFile("optimizer_tests.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	var suite OptimizerTestSuite
+	err = yaml.Unmarshal(data, &suite)
+	if err != nil {
+		return nil, err
+	}
+
+	return suite.Tests, nil
+}
+
+func TestOptimizerCases(t *testing.T) {
+	testCases, err := loadOptimizerTests()
+	if err != nil {
+		t.Fatalf("Failed to load test cases: %v", err)
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			result := optimizeToString(tc.Input)
+			expected := strings.TrimRight(tc.Expected, "\n")
+			if result != expected {
+				t.Errorf("Test %s failed:\nExpected:\n%s\nGot:\n%s", tc.Name, expected, result)
+			}
+		})
+	}
+}
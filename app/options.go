@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// Options holds the command-line flags that precede the filename
+type Options struct {
+	Cache            bool
+	ExitParseError   int
+	ExitRuntimeError int
+	Formatter        Formatter
+	LoopReturnsLast  bool
+	Optimize         bool
+	Precision        int
+	StrictVars       bool
+}
+
+// Default exit codes, following the sysexits.h convention CodeCrafters
+// expects: EX_DATAERR for tokenize/parse errors and EX_SOFTWARE for
+// runtime errors
+const (
+	defaultExitParseError   = 65
+	defaultExitRuntimeError = 70
+)
+
+// parseOptions parses the flags for command from args and returns the
+// options along with the remaining positional arguments
+func parseOptions(command string, args []string, errOutput io.Writer) (Options, []string, error) {
+	opts := Options{
+		ExitParseError:   defaultExitParseError,
+		ExitRuntimeError: defaultExitRuntimeError,
+		Formatter:        HumanFormatter{},
+	}
+	// The environment sets the exit codes; flags override it
+	for name, code := range map[string]*int{
+		"LOX_EXIT_PARSE_ERROR":   &opts.ExitParseError,
+		"LOX_EXIT_RUNTIME_ERROR": &opts.ExitRuntimeError,
+	} {
+		if err := exitCodeFromEnv(name, code); err != nil {
+			fmt.Fprintln(errOutput, err)
+			return opts, nil, err
+		}
+	}
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.SetOutput(errOutput)
+	fs.Func("format", "how to render the evaluate result: human, json or source (default human)", func(name string) error {
+		formatter, err := NewFormatter(name)
+		if err != nil {
+			return err
+		}
+		opts.Formatter = formatter
+		return nil
+	})
+
+	var quoteStrings bool
+	fs.BoolVar(&quoteStrings, "quote-strings", false, "quote string results in the human format")
+	fs.BoolVar(&opts.StrictVars, "strict-vars", false, "make reading a variable declared without a value an error instead of nil")
+	fs.BoolVar(&opts.Cache, "cache", false, "reuse the parsed AST of an unchanged file from the user cache directory")
+	fs.BoolVar(&opts.Optimize, "optimize", false, "fold constant expressions and propagate constant variables before parse output or evaluation")
+	fs.Func("exit-parse-error", fmt.Sprintf("exit code for tokenize and parse errors (also $LOX_EXIT_PARSE_ERROR) (default %d)", defaultExitParseError), func(value string) (err error) {
+		opts.ExitParseError, err = parseExitCode(value)
+		return err
+	})
+	fs.Func("exit-runtime-error", fmt.Sprintf("exit code for runtime and undefined-variable errors (also $LOX_EXIT_RUNTIME_ERROR) (default %d)", defaultExitRuntimeError), func(value string) (err error) {
+		opts.ExitRuntimeError, err = parseExitCode(value)
+		return err
+	})
+	fs.Func("precision", fmt.Sprintf("significant digits shown for non-integer numbers, 1 to %d (default shortest exact form)", maxPrecision), func(value string) error {
+		precision, err := strconv.Atoi(value)
+		if err != nil || precision < 1 || precision > maxPrecision {
+			return fmt.Errorf("expected a number of digits from 1 to %d", maxPrecision)
+		}
+		opts.Precision = precision
+		return nil
+	})
+	fs.BoolVar(&opts.LoopReturnsLast, "loop-returns-last", false, "make while and for loops evaluate to their last body value instead of nil")
+
+	if err := fs.Parse(args); err != nil {
+		return opts, nil, err
+	}
+	if _, isHuman := opts.Formatter.(HumanFormatter); isHuman {
+		opts.Formatter = HumanFormatter{QuoteStrings: quoteStrings, Precision: opts.Precision}
+	}
+	return opts, fs.Args(), nil
+}
+
+// exitCodeFromEnv sets code from the environment variable name, if set
+func exitCodeFromEnv(name string, code *int) error {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	parsed, err := parseExitCode(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	*code = parsed
+	return nil
+}
+
+// parseExitCode reads an exit code that signals failure. Zero would report
+// success and the OS truncates codes outside a byte, so only 1 to 255 are
+// accepted.
+func parseExitCode(value string) (int, error) {
+	code, err := strconv.Atoi(value)
+	if err != nil || code < 1 || code > 255 {
+		return 0, fmt.Errorf("expected an exit code from 1 to 255")
+	}
+	return code, nil
+}
+
+// Prepare applies the AST passes enabled by these options
+func (o Options) Prepare(expr Expr) Expr {
+	if o.Optimize {
+		return NewOptimizer().Optimize(expr)
+	}
+	return expr
+}
+
+// NewEvaluator creates an evaluator configured by these options
+func (o Options) NewEvaluator(scope *Scope, output io.Writer) *Evaluator {
+	evaluator := NewEvaluator(scope, output)
+	evaluator.loopReturnsLast = o.LoopReturnsLast
+	evaluator.precision = o.Precision
+	evaluator.strictVars = o.StrictVars
+	return evaluator
+}
@@ -5,6 +5,11 @@ import (
 	"strconv"
 )
 
+// parserVersion identifies how source text is turned into an AST. Bump it
+// whenever a tokenizer or parser change makes the same source parse into a
+// different tree, so cached ASTs from older builds are not reused.
+const parserVersion = 1
+
 // Parser converts tokens into an AST
 type Parser struct {
 	tokens  []Token
@@ -193,6 +198,7 @@ func (p *Parser) finishCall(callee Expr) (Expr, error) {
 // ; not required when Block is next
 func (p *Parser) statements() (Expr, error) {
 	var results []Expr
+	var ends []int
 	expr, err := p.expression()
 	if err != nil {
 		return nil, err
@@ -201,6 +207,7 @@ func (p *Parser) statements() (Expr, error) {
 	results = append(results, expr)
 	for {
 		_ = p.match(SEMICOLON)
+		ends = append(ends, p.current)
 		expr, err := p.expression()
 
 		if err != nil {
@@ -212,7 +219,7 @@ func (p *Parser) statements() (Expr, error) {
 	if len(results) == 1 {
 		return results[0], nil
 	}
-	return &Statements{Exprs: results, Line: line}, nil
+	return &Statements{Exprs: results, Line: line, ends: ends}, nil
 
 }
 
@@ -276,7 +283,8 @@ func (p *Parser) primary() (Expr, error) {
 		}
 		varName := p.previous().Lexeme
 		if !p.match(EQUAL) {
-			return &VarStatement{name: varName, Expression: &Literal{Value: NilValue{}, Line: p.previous().Line}, Line: p.tokens[p.current-2].Line}, nil
+			// No initializer: the variable starts out uninitialized
+			return &VarStatement{name: varName, Line: p.tokens[p.current-2].Line}, nil
 		}
 		expr, err := p.expression()
 		if err != nil {
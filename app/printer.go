@@ -8,6 +8,8 @@ import (
 // AstPrinter implements the visitor pattern to print AST as S-expressions
 type AstPrinter struct{}
 
+var _ ExprVisitor = (*AstPrinter)(nil)
+
 // Print converts an expression to its S-expression string representation
 func (ap *AstPrinter) Print(expr Expr) string {
 	if expr == nil {
@@ -36,11 +38,7 @@ func (ap *AstPrinter) VisitLiteralExpr(expr *Literal) Value {
 	case NilValue:
 		return StringValue{Val: "nil"}
 	case NumberValue:
-		// Format numbers to match expected output
-		if v.Val == float64(int64(v.Val)) {
-			return StringValue{Val: fmt.Sprintf("%.1f", v.Val)}
-		}
-		return StringValue{Val: fmt.Sprintf("%g", v.Val)}
+		return StringValue{Val: formatNumberLiteral(v.Val)}
 	case StringValue:
 		return StringValue{Val: v.Val}
 	case BoolValue:
@@ -73,7 +71,9 @@ func (ap *AstPrinter) VisitStatements(expr *Statements) Value {
 
 func (ap *AstPrinter) VisitVarStatement(expr *VarStatement) Value {
 	var strVal string
-	if str, ok := expr.Expression.Accept(ap).(StringValue); ok {
+	if expr.Expression == nil {
+		strVal = "nil"
+	} else if str, ok := expr.Expression.Accept(ap).(StringValue); ok {
 		strVal = str.Val
 	} else {
 		strVal = "?"
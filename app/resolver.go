@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ResolveError reports a variable used where no declaration is in scope
+type ResolveError struct {
+	Message string
+	Line    uint
+}
+
+// Error renders the error as the evaluator reports runtime errors, since
+// the resolver catches mistakes that used to be found at runtime
+func (r ResolveError) Error() string {
+	return fmt.Sprintf("[Line %d]\nError: %s", r.Line, r.Message)
+}
+
+// Resolver walks the AST once before evaluation and reports every use of a
+// name that is not declared in an enclosing scope. Scopes mirror the ones
+// the Evaluator creates for blocks, for loops and function calls.
+type Resolver struct {
+	scopes []map[string]bool
+	// deferred holds, per statement list being resolved, the functions
+	// declared in it. Their bodies are resolved once the whole list has
+	// been seen, since a body runs later and can use names declared after it.
+	deferred [][]*Fun
+	errors   []ResolveError
+}
+
+var _ ExprVisitor = (*Resolver)(nil)
+
+// NewResolver creates a resolver whose outermost scope holds the builtins
+func NewResolver() *Resolver {
+	globals := make(map[string]bool)
+	for _, builtin := range builtins {
+		globals[builtin.Name] = true
+	}
+	return &Resolver{scopes: []map[string]bool{globals}}
+}
+
+// Resolve checks expr and returns the errors found, ordered by line
+func (r *Resolver) Resolve(expr Expr) []ResolveError {
+	if expr == nil {
+		return nil
+	}
+	if stmts, ok := expr.(*Statements); ok {
+		r.resolveStatements(stmts.Exprs)
+	} else {
+		r.resolveStatements([]Expr{expr})
+	}
+	sort.SliceStable(r.errors, func(i, j int) bool {
+		return r.errors[i].Line < r.errors[j].Line
+	})
+	return r.errors
+}
+
+func (r *Resolver) VisitBinaryExpr(expr *Binary) Value {
+	if expr.Operator.Type == EQUAL {
+		r.resolve(expr.Right)
+		if variable, ok := expr.Left.(*Variable); ok {
+			r.checkDefined(variable.Name.Lexeme, expr.Line)
+			return NilValue{}
+		}
+	}
+	r.resolve(expr.Left, expr.Right)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitGroupingExpr(expr *Grouping) Value {
+	r.resolve(expr.Expression)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitLiteralExpr(expr *Literal) Value {
+	return NilValue{}
+}
+
+func (r *Resolver) VisitUnaryExpr(expr *Unary) Value {
+	r.resolve(expr.Right)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitVariableExpr(expr *Variable) Value {
+	r.checkDefined(expr.Name.Lexeme, expr.Line)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitPrintStatement(expr *PrintStatement) Value {
+	r.resolve(expr.Expression)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitStatements(expr *Statements) Value {
+	r.resolveStatements(expr.Exprs)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitVarStatement(expr *VarStatement) Value {
+	// The initializer is resolved before the name exists
+	r.resolve(expr.Expression)
+	r.declare(expr.name)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitBlock(expr *Block) Value {
+	r.beginScope()
+	r.resolveStatements(expr.Statements)
+	r.endScope()
+	return NilValue{}
+}
+
+func (r *Resolver) VisitIfStatement(expr *IfStatement) Value {
+	r.resolve(expr.Condition, expr.ThenBranch, expr.ElseBranch)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitWhileStatement(expr *WhileStatement) Value {
+	r.resolve(expr.Condition, expr.Body)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitForStatement(expr *ForStatement) Value {
+	r.beginScope()
+	r.resolve(expr.Initializer, expr.Condition, expr.Increment, expr.Body)
+	r.endScope()
+	return NilValue{}
+}
+
+func (r *Resolver) VisitCallExpr(expr *Call) Value {
+	r.resolve(expr.Callee)
+	r.resolve(expr.Arguments...)
+	return NilValue{}
+}
+
+func (r *Resolver) VisitFun(expr *Fun) Value {
+	r.declare(expr.Name)
+	last := len(r.deferred) - 1
+	r.deferred[last] = append(r.deferred[last], expr)
+	return NilValue{}
+}
+
+// resolveStatements resolves a statement list the way evalStatements runs
+// it: functions are hoisted first, and their bodies are checked at the end
+func (r *Resolver) resolveStatements(statements []Expr) {
+	for _, stmt := range statements {
+		if fun, ok := stmt.(*Fun); ok {
+			r.declare(fun.Name)
+		}
+	}
+
+	r.deferred = append(r.deferred, nil)
+	r.resolve(statements...)
+
+	last := len(r.deferred) - 1
+	funs := r.deferred[last]
+	r.deferred = r.deferred[:last]
+	for _, fun := range funs {
+		r.resolveFunctionBody(fun)
+	}
+}
+
+// resolveFunctionBody checks a function body in a scope holding its
+// parameters, matching the scope a call creates
+func (r *Resolver) resolveFunctionBody(fun *Fun) {
+	r.beginScope()
+	for _, param := range fun.Parameters {
+		r.declare(param)
+	}
+	r.resolveStatements(fun.Block.Statements)
+	r.endScope()
+}
+
+func (r *Resolver) resolve(exprs ...Expr) {
+	for _, expr := range exprs {
+		if expr != nil {
+			expr.Accept(r)
+		}
+	}
+}
+
+func (r *Resolver) beginScope() {
+	r.scopes = append(r.scopes, make(map[string]bool))
+}
+
+func (r *Resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *Resolver) declare(name string) {
+	r.scopes[len(r.scopes)-1][name] = true
+}
+
+func (r *Resolver) checkDefined(name string, line uint) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if r.scopes[i][name] {
+			return
+		}
+	}
+	r.errors = append(r.errors, ResolveError{
+		Message: fmt.Sprintf("Undefined variable '%s'", name),
+		Line:    line,
+	})
+}
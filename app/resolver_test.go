@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func resolveToString(input string) string {
+	tokens, err := TokenizeString(input)
+	if err != nil {
+		return "Tokenization error: " + err.Error()
+	}
+
+	parser := NewParser(tokens)
+	expr, err := parser.Parse()
+	if err != nil {
+		return "Parse error: " + err.Error()
+	}
+
+	var lines []string
+	for _, resolveErr := range NewResolver().Resolve(expr) {
+		lines = append(lines, resolveErr.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+type ResolverTestCase struct {
+	Name     string `yaml:"name"`
+	Input    string `yaml:"input"`
+	Expected string `yaml:"expected"`
+}
+
+type ResolverTestSuite struct {
+	Tests []ResolverTestCase `yaml:"resolver_tests"`
+}
+
+func loadResolverTests() ([]ResolverTestCase, error) {
+	data, err := os.ReadFile("resolver_tests.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	var suite ResolverTestSuite
+	err = yaml.Unmarshal(data, &suite)
+	if err != nil {
+		return nil, err
+	}
+
+	return suite.Tests, nil
+}
+
+func TestResolverCases(t *testing.T) {
+	testCases, err := loadResolverTests()
+	if err != nil {
+		t.Fatalf("Failed to load test cases: %v", err)
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+			result := resolveToString(tc.Input)
+			expected := strings.TrimRight(tc.Expected, "\n")
+			if result != expected {
+				t.Errorf("Test %s failed:\nExpected:\n%s\nGot:\n%s", tc.Name, expected, result)
+			}
+		})
+	}
+}
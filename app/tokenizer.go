@@ -196,13 +196,7 @@ func TokenizeReader(reader *bufio.Reader) ([]Token, error) {
 					}
 					errors = append(errors, fmt.Sprintf("invalid number: %s", numStr))
 				} else {
-					// Format with minimum 1 decimal place but only as many as needed
-					formatted := fmt.Sprintf("%g", floatVal)
-					// If no decimal point, add .0
-					if !strings.Contains(formatted, ".") {
-						formatted += ".0"
-					}
-					result = append(result, Token{NUMBER, numStr, formatted, lineNo})
+					result = append(result, Token{NUMBER, numStr, formatNumberLiteral(floatVal), lineNo})
 				}
 			} else if unicode.IsLetter(rune(b)) || b == '_' {
 				idStr, tokens, err2 := readIdentifier(reader, b, result)
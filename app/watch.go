@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// watchInterval is how often the watch command checks the file for changes
+const watchInterval = 500 * time.Millisecond
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// Watcher evaluates a file and evaluates it again each time it changes
+type Watcher struct {
+	Filename string
+	Options  Options
+	Stdout   io.Writer
+	Stderr   io.Writer
+	// modTime reports when the file last changed, and wait blocks until the
+	// next check, returning false to stop. Tests replace both to simulate
+	// edits without sleeping.
+	modTime func(filename string) (time.Time, error)
+	wait    func() bool
+}
+
+// NewWatcher creates a watcher that polls filename every watchInterval
+func NewWatcher(filename string, opts Options, stdout, stderr io.Writer) *Watcher {
+	return &Watcher{
+		Filename: filename,
+		Options:  opts,
+		Stdout:   stdout,
+		Stderr:   stderr,
+		modTime:  fileModTime,
+		wait: func() bool {
+			time.Sleep(watchInterval)
+			return true
+		},
+	}
+}
+
+// Run evaluates the file, then re-evaluates it whenever its modification
+// time changes. Syntax and runtime errors are reported like the evaluate
+// command does, but watching carries on so the next save can fix them.
+func (w *Watcher) Run() {
+	last, _ := w.modTime(w.Filename)
+	w.evaluate()
+	for w.wait() {
+		// The file may briefly be missing while an editor saves it
+		current, err := w.modTime(w.Filename)
+		if err != nil || current.Equal(last) {
+			continue
+		}
+		last = current
+		w.evaluate()
+	}
+}
+
+func (w *Watcher) evaluate() {
+	fmt.Fprint(w.Stdout, clearScreen)
+	handleEvaluate(w.Filename, w.Options, true, w.Stdout, w.Stderr)
+}
+
+func fileModTime(filename string) (time.Time, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
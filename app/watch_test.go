@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcherReevaluatesOnChange(t *testing.T) {
+	filename := writeProgram(t, "1 + 2")
+	var stdout, stderr bytes.Buffer
+	opts, _, err := parseOptions("watch", nil, io.Discard)
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+	watcher := NewWatcher(filename, opts, &stdout, &stderr)
+
+	// Each step is one poll: the source saved before it (if any) and
+	// whether that save changed the modification time
+	steps := []struct {
+		source  string
+		changed bool
+	}{
+		{"", false},
+		{"print ;", true},
+		{"", false},
+		{"3 + 4", true},
+		{"5 + 6", false},
+	}
+	modified := time.Unix(0, 0)
+	step := -1
+	watcher.modTime = func(string) (time.Time, error) {
+		return modified, nil
+	}
+	watcher.wait = func() bool {
+		step++
+		if step == len(steps) {
+			return false
+		}
+		if steps[step].source != "" {
+			if err := os.WriteFile(filename, []byte(steps[step].source), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if steps[step].changed {
+			modified = modified.Add(time.Second)
+		}
+		return true
+	}
+
+	watcher.Run()
+
+	results := strings.Split(stdout.String(), clearScreen)[1:]
+	expected := []string{"3\n", "", "7\n"}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d evaluations, got %d: %q", len(expected), len(results), results)
+	}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("Evaluation %d: expected %q, got %q", i+1, expected[i], results[i])
+		}
+	}
+	if !strings.Contains(stderr.String(), "Parse error") {
+		t.Errorf("Expected the parse error to be reported, got %q", stderr.String())
+	}
+}